@@ -0,0 +1,202 @@
+package codec
+
+import (
+	"ecommerce_product_listing/models"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type FeedFormat string
+
+const (
+	FeedGoogleMerchant FeedFormat = "google"
+	FeedFacebook       FeedFormat = "facebook"
+)
+
+func ParseFeedFormat(value string) (FeedFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "google", "google_merchant", "rss", "xml":
+		return FeedGoogleMerchant, nil
+	case "facebook", "fb", "meta":
+		return FeedFacebook, nil
+	}
+	return "", fmt.Errorf("unsupported feed format %q", value)
+}
+
+func (f FeedFormat) ContentType() string {
+	if f == FeedFacebook {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/rss+xml; charset=utf-8"
+}
+
+func (f FeedFormat) Extension() string {
+	if f == FeedFacebook {
+		return "csv"
+	}
+	return "xml"
+}
+
+// FeedChannel describes the catalog in the RSS channel header.
+type FeedChannel struct {
+	Title       string
+	Link        string
+	Description string
+}
+
+func NewFeedWriter(format FeedFormat, w io.Writer, channel FeedChannel) (ProductWriter, error) {
+	switch format {
+	case FeedGoogleMerchant:
+		return &googleFeedWriter{w: w, encoder: xml.NewEncoder(w), channel: channel}, nil
+	case FeedFacebook:
+		return &facebookFeedWriter{writer: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported feed format %q", format)
+}
+
+// feedID prefers the ASIN, which stays stable across re-imports, over the row id.
+func feedID(p *models.Product) string {
+	if p.ASIN != "" {
+		return p.ASIN
+	}
+	return strconv.Itoa(p.ID)
+}
+
+func feedPrice(p *models.Product) string {
+	return strconv.FormatFloat(p.Price, 'f', 2, 64) + " " + p.Currency
+}
+
+// googleItem is one <item> in a Google Merchant Center RSS 2.0 feed.
+type googleItem struct {
+	XMLName      xml.Name `xml:"item"`
+	ID           string   `xml:"g:id"`
+	Title        string   `xml:"g:title"`
+	Description  string   `xml:"g:description,omitempty"`
+	Link         string   `xml:"g:link,omitempty"`
+	ImageLink    string   `xml:"g:image_link,omitempty"`
+	Price        string   `xml:"g:price"`
+	Availability string   `xml:"g:availability"`
+	Brand        string   `xml:"g:brand,omitempty"`
+	Condition    string   `xml:"g:condition"`
+	ProductType  string   `xml:"g:product_type,omitempty"`
+}
+
+type googleFeedWriter struct {
+	w         io.Writer
+	encoder   *xml.Encoder
+	channel   FeedChannel
+	wroteHead bool
+}
+
+func (g *googleFeedWriter) writeHead() error {
+	if g.wroteHead {
+		return nil
+	}
+	g.wroteHead = true
+
+	if _, err := io.WriteString(g.w, xml.Header+`<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0"><channel>`); err != nil {
+		return err
+	}
+	for _, element := range []struct{ name, value string }{
+		{"title", g.channel.Title},
+		{"link", g.channel.Link},
+		{"description", g.channel.Description},
+	} {
+		if err := g.encoder.EncodeElement(element.value, xml.StartElement{Name: xml.Name{Local: element.name}}); err != nil {
+			return err
+		}
+	}
+	return g.encoder.Flush()
+}
+
+func (g *googleFeedWriter) Write(p *models.Product) error {
+	if err := g.writeHead(); err != nil {
+		return err
+	}
+
+	availability := "out_of_stock"
+	if p.Stock > 0 {
+		availability = "in_stock"
+	}
+
+	return g.encoder.Encode(googleItem{
+		ID:           feedID(p),
+		Title:        p.Title,
+		Description:  p.Description,
+		Link:         p.ProductURL,
+		ImageLink:    p.ImageURL,
+		Price:        feedPrice(p),
+		Availability: availability,
+		Brand:        p.Brand,
+		Condition:    "new",
+		ProductType:  p.Category,
+	})
+}
+
+func (g *googleFeedWriter) Flush() error { return g.encoder.Flush() }
+
+func (g *googleFeedWriter) Close() error {
+	if err := g.writeHead(); err != nil {
+		return err
+	}
+	if err := g.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(g.w, "</channel></rss>\n")
+	return err
+}
+
+// facebookColumns are the required columns of a Facebook (Meta) catalog CSV.
+var facebookColumns = []string{"id", "title", "description", "availability", "condition", "price", "link", "image_link", "brand"}
+
+type facebookFeedWriter struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func (f *facebookFeedWriter) writeHeader() error {
+	if f.wroteHeader {
+		return nil
+	}
+	f.wroteHeader = true
+	return f.writer.Write(facebookColumns)
+}
+
+func (f *facebookFeedWriter) Write(p *models.Product) error {
+	if err := f.writeHeader(); err != nil {
+		return err
+	}
+
+	availability := "out of stock"
+	if p.Stock > 0 {
+		availability = "in stock"
+	}
+
+	return f.writer.Write([]string{
+		feedID(p),
+		p.Title,
+		p.Description,
+		availability,
+		"new",
+		feedPrice(p),
+		p.ProductURL,
+		p.ImageURL,
+		p.Brand,
+	})
+}
+
+func (f *facebookFeedWriter) Flush() error {
+	f.writer.Flush()
+	return f.writer.Error()
+}
+
+func (f *facebookFeedWriter) Close() error {
+	if err := f.writeHeader(); err != nil {
+		return err
+	}
+	return f.Flush()
+}
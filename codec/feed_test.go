@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"bytes"
+	"ecommerce_product_listing/models"
+	"encoding/csv"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFeed(t *testing.T, format FeedFormat, products []models.Product) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, err := NewFeedWriter(format, &buf, FeedChannel{Title: "Shop & Co", Link: "https://shop.example", Description: "All products"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range products {
+		if err := writer.Write(&products[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGoogleFeed(t *testing.T) {
+	products := exportProducts()
+	products[1].ID = 7
+	out := writeFeed(t, FeedGoogleMerchant, products)
+
+	const ns = "http://base.google.com/ns/1.0"
+	var feed struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+			Items []struct {
+				ID           string `xml:"http://base.google.com/ns/1.0 id"`
+				Title        string `xml:"http://base.google.com/ns/1.0 title"`
+				Description  string `xml:"http://base.google.com/ns/1.0 description"`
+				Price        string `xml:"http://base.google.com/ns/1.0 price"`
+				Availability string `xml:"http://base.google.com/ns/1.0 availability"`
+				Condition    string `xml:"http://base.google.com/ns/1.0 condition"`
+				Brand        string `xml:"http://base.google.com/ns/1.0 brand"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal([]byte(out), &feed); err != nil {
+		t.Fatalf("feed is not valid XML: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, `xmlns:g="`+ns+`"`) {
+		t.Errorf("feed does not declare the g namespace:\n%s", out)
+	}
+
+	if feed.Version != "2.0" || feed.Channel.Title != "Shop & Co" || feed.Channel.Link != "https://shop.example" {
+		t.Errorf("channel = version %q title %q link %q", feed.Version, feed.Channel.Title, feed.Channel.Link)
+	}
+	if len(feed.Channel.Items) != 2 {
+		t.Fatalf("items = %d, want 2", len(feed.Channel.Items))
+	}
+	first, second := feed.Channel.Items[0], feed.Channel.Items[1]
+	if first.ID != "B001" || first.Title != `Cable, USB-C "fast"` || first.Description != "Line one\nline two" ||
+		first.Price != "12.50 USD" || first.Availability != "in_stock" || first.Condition != "new" || first.Brand != "Anker" {
+		t.Errorf("first item = %+v", first)
+	}
+	// No ASIN falls back to the id; no stock is out_of_stock
+	if second.ID != "7" || second.Price != "30.00 EUR" || second.Availability != "out_of_stock" {
+		t.Errorf("second item = %+v", second)
+	}
+}
+
+func TestGoogleFeedEmpty(t *testing.T) {
+	out := writeFeed(t, FeedGoogleMerchant, nil)
+
+	var feed struct {
+		Channel struct {
+			Title string   `xml:"title"`
+			Items []string `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal([]byte(out), &feed); err != nil {
+		t.Fatalf("empty feed is not valid XML: %v\n%s", err, out)
+	}
+	if feed.Channel.Title != "Shop & Co" || len(feed.Channel.Items) != 0 {
+		t.Errorf("empty feed = %+v", feed)
+	}
+}
+
+func TestFacebookFeed(t *testing.T) {
+	products := exportProducts()
+	products[1].ID = 7
+	out := writeFeed(t, FeedFacebook, products)
+
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("feed is not valid CSV: %v\n%s", err, out)
+	}
+	want := [][]string{
+		facebookColumns,
+		{"B001", `Cable, USB-C "fast"`, "Line one\nline two", "in stock", "new", "12.50 USD", "https://shop.example/1", "https://img.example/1.jpg", "Anker"},
+		{"7", "Tischlampe für Büro", "", "out of stock", "new", "30.00 EUR", "", "", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+
+	if out := writeFeed(t, FeedFacebook, nil); out != strings.Join(facebookColumns, ",")+"\n" {
+		t.Errorf("empty feed = %q, want just the header", out)
+	}
+}
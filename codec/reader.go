@@ -0,0 +1,206 @@
+package codec
+
+import (
+	"bufio"
+	"ecommerce_product_listing/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson"
+	FormatCSV    Format = "csv"
+)
+
+// ParseFormat maps a format query value or a Content-Type to a Format.
+func ParseFormat(value string) (Format, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "" || value == "ndjson" || strings.Contains(value, "ndjson") || strings.Contains(value, "jsonl"):
+		return FormatNDJSON, nil
+	case value == "csv" || strings.Contains(value, "text/csv"):
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("unsupported format %q", value)
+}
+
+// NewProductSource decodes a streamed body one product at a time.
+func NewProductSource(format Format, r io.Reader) (models.ProductSource, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonSource{scanner: newLineScanner(r)}, nil
+	case FormatCSV:
+		return newCSVSource(r)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+const maxLineBytes = 1 << 20
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	return scanner
+}
+
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (s *ndjsonSource) Next() (*models.Product, int, error) {
+	for s.scanner.Scan() {
+		s.line++
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var p models.Product
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			decodeErr := &models.RowDecodeError{Line: s.line, Err: err}
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				decodeErr.Field = typeErr.Field
+			}
+			return nil, s.line, decodeErr
+		}
+		return &p, s.line, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, s.line, err
+	}
+	return nil, s.line, io.EOF
+}
+
+// CSVColumns is the header written by the CSV encoder and accepted by the decoder.
+// Names match the product JSON fields.
+var CSVColumns = []string{
+	"id", "title", "asin", "description", "category", "brand", "image_url", "product_url",
+	"price", "currency", "country", "stock", "avg_rating", "review_count",
+	"bought_in_last_month", "is_best_seller", "created_at", "updated_at",
+}
+
+type csvSource struct {
+	reader  *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func newCSVSource(r io.Reader) (*csvSource, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("csv header must include a title column")
+	}
+
+	return &csvSource{reader: reader, columns: columns, line: 1}, nil
+}
+
+func (s *csvSource) Next() (*models.Product, int, error) {
+	record, err := s.reader.Read()
+	s.line++
+	if err == io.EOF {
+		return nil, s.line, io.EOF
+	}
+	// A malformed record doesn't stop the reader from parsing the next one
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, s.line, &models.RowDecodeError{Line: s.line, Err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, s.line, err
+	}
+
+	field := func(name string) string {
+		if i, ok := s.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	p := &models.Product{
+		Title:       field("title"),
+		ASIN:        field("asin"),
+		Description: field("description"),
+		Category:    field("category"),
+		Brand:       field("brand"),
+		ImageURL:    field("image_url"),
+		ProductURL:  field("product_url"),
+		Currency:    field("currency"),
+		Country:     field("country"),
+	}
+
+	for _, parse := range []struct {
+		column string
+		fn     func(value string) error
+	}{
+		{"price", func(v string) (err error) { p.Price, err = parseFloat(v); return }},
+		{"stock", func(v string) (err error) { p.Stock, err = parseInt(v); return }},
+		{"avg_rating", func(v string) (err error) { p.AvgRating, err = parseOptionalFloat(v); return }},
+		{"review_count", func(v string) (err error) { p.ReviewCount, err = parseOptionalInt(v); return }},
+		{"bought_in_last_month", func(v string) (err error) { p.BoughtInLastMonth, err = parseOptionalInt(v); return }},
+		{"is_best_seller", func(v string) (err error) { p.IsBestSeller, err = parseBool(v); return }},
+	} {
+		if err := parse.fn(field(parse.column)); err != nil {
+			return nil, s.line, &models.RowDecodeError{Line: s.line, Field: parse.column, Err: err}
+		}
+	}
+
+	return p, s.line, nil
+}
+
+// Empty cells decode to zero values; pandas writes whole numbers as "12.0".
+func parseFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func parseInt(value string) (int, error) {
+	f, err := parseFloat(value)
+	return int(f), err
+}
+
+// Empty cells in nullable columns decode to nil, i.e. NULL.
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := parseFloat(value)
+	return &f, err
+}
+
+func parseOptionalInt(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	i, err := parseInt(value)
+	return &i, err
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"ecommerce_product_listing/models"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ProductWriter encodes products one at a time onto a stream. Flush pushes out
+// buffered rows mid-stream; Close finishes the document and must be called once.
+type ProductWriter interface {
+	Write(p *models.Product) error
+	Flush() error
+	Close() error
+}
+
+// ContentType is the response Content-Type for a format.
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+func NewProductWriter(format Format, w io.Writer) (ProductWriter, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(p *models.Product) error { return w.encoder.Encode(p) }
+
+func (w *ndjsonWriter) Flush() error { return nil }
+
+func (w *ndjsonWriter) Close() error { return nil }
+
+type csvWriter struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func (w *csvWriter) Write(p *models.Product) error {
+	if !w.wroteHeader {
+		if err := w.writer.Write(CSVColumns); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	return w.writer.Write([]string{
+		strconv.Itoa(p.ID),
+		p.Title,
+		p.ASIN,
+		p.Description,
+		p.Category,
+		p.Brand,
+		p.ImageURL,
+		p.ProductURL,
+		strconv.FormatFloat(p.Price, 'f', 2, 64),
+		p.Currency,
+		p.Country,
+		strconv.Itoa(p.Stock),
+		formatOptionalFloat(p.AvgRating),
+		formatOptionalInt(p.ReviewCount),
+		formatOptionalInt(p.BoughtInLastMonth),
+		strconv.FormatBool(p.IsBestSeller),
+		formatTime(p.CreatedAt),
+		formatTime(p.UpdatedAt),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Close writes the header even for an empty export, so the output is always valid CSV.
+func (w *csvWriter) Close() error {
+	if !w.wroteHeader {
+		if err := w.writer.Write(CSVColumns); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+	return w.Flush()
+}
+
+// NULL numbers are written as empty cells.
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func formatOptionalInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
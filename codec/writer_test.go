@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"bytes"
+	"ecommerce_product_listing/models"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// exportProducts covers the awkward cases: quoting, newlines, unicode and NULLs.
+func exportProducts() []models.Product {
+	created := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+	return []models.Product{
+		{ID: 1, Title: `Cable, USB-C "fast"`, ASIN: "B001", Description: "Line one\nline two", Category: "Electronics", Brand: "Anker", ImageURL: "https://img.example/1.jpg", ProductURL: "https://shop.example/1", Price: 12.5, Currency: "USD", Country: "US", Stock: 3, AvgRating: ptr(4.5), ReviewCount: ptr(120), BoughtInLastMonth: ptr(900), IsBestSeller: true, CreatedAt: &created, UpdatedAt: &created},
+		{ID: 2, Title: "Tischlampe für Büro", Price: 30, Currency: "EUR"},
+	}
+}
+
+func TestProductWriterRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatNDJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewProductWriter(format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			products := exportProducts()
+			for i := range products {
+				if err := writer.Write(&products[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			src, err := NewProductSource(format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range products {
+				got, _, err := src.Next()
+				if err != nil {
+					t.Fatalf("row %d: %v", i, err)
+				}
+				want := products[i]
+				// The import side assigns ids and timestamps itself, so CSV doesn't read them back
+				if format == FormatCSV {
+					want.ID, want.CreatedAt, want.UpdatedAt = 0, nil, nil
+				}
+				if !reflect.DeepEqual(*got, want) {
+					t.Errorf("row %d = %+v, want %+v", i, *got, want)
+				}
+			}
+			if _, _, err := src.Next(); err != io.EOF {
+				t.Errorf("after last row err = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestCSVWriterEmptyExport(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewProductWriter(FormatCSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewProductSource(FormatCSV, &buf)
+	if err != nil {
+		t.Fatalf("empty export has no readable header: %v", err)
+	}
+	if _, _, err := src.Next(); err != io.EOF {
+		t.Errorf("err = %v, want EOF", err)
+	}
+}
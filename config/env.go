@@ -1,21 +1,102 @@
 package config
 
 import (
+	"crypto/rand"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/joho/godotenv"
 )
 
-// LoadEnv loads variables from .env into the process environment.
+// LoadEnv loads variables from .env into the process environment. Outside
+// development it exits when CURSOR_SECRET is missing.
 func LoadEnv() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found; relying on existing environment variables")
 	}
 
+	if os.Getenv("CURSOR_SECRET") == "" && Environment() != Development {
+		log.Fatalf("CURSOR_SECRET is required when APP_ENV=%s: without it cursors break across restarts and instances", Environment())
+	}
+
 	// PRINT ENV VARIABLES FOR DEBUGGING PURPOSES
 	log.Println("Environment variables loaded:")
 	for _, key := range []string{"DATABASE_URL", "DATABASE_NAME"} {
 		log.Printf("%s=%s\n", key, os.Getenv(key))
 	}
 }
+
+// FeedTitle, FeedLink and FeedDescription describe the catalog in syndication feed headers.
+func FeedTitle() string {
+	return getEnv("FEED_TITLE", "Product Catalog")
+}
+
+func FeedLink() string {
+	return getEnv("FEED_LINK", "http://localhost:8080")
+}
+
+func FeedDescription() string {
+	return getEnv("FEED_DESCRIPTION", "Product feed")
+}
+
+// Development is the default APP_ENV, where missing secrets are generated.
+const Development = "development"
+
+// Environment names the deployment from APP_ENV.
+func Environment() string {
+	return getEnv("APP_ENV", Development)
+}
+
+const (
+	PostgresStore = "postgres"
+	MemoryStore   = "memory"
+)
+
+// StoreBackend selects where products live: Postgres by default, or an in-process
+// memory store (STORE=memory) for running the API without a database.
+func StoreBackend() string {
+	return getEnv("STORE", PostgresStore)
+}
+
+// StoreSeedFile is an optional CSV or NDJSON file loaded into the memory store on startup.
+func StoreSeedFile() string {
+	return os.Getenv("STORE_SEED")
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+var (
+	cursorSecret     []byte
+	cursorSecretOnce sync.Once
+)
+
+// CursorSecret is the HMAC key for pagination cursors. Without CURSOR_SECRET, which
+// LoadEnv only allows in development, a random key is generated, so cursors stop
+// validating across restarts and between instances.
+func CursorSecret() []byte {
+	cursorSecretOnce.Do(func() {
+		if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+			cursorSecret = []byte(secret)
+			return
+		}
+
+		log.Println("WARNING: CURSOR_SECRET not set; generating a per-process cursor key. " +
+			"Cursors will not survive a restart or work across instances")
+		cursorSecret = make([]byte, 32)
+		if _, err := rand.Read(cursorSecret); err != nil {
+			log.Fatal("Unable to generate cursor secret:", err)
+		}
+	})
+	return cursorSecret
+}
+
+// AdminAPIKey is the shared secret for admin-only endpoints. Empty disables them.
+func AdminAPIKey() string {
+	return os.Getenv("ADMIN_API_KEY")
+}
@@ -53,7 +53,8 @@ func Initialize() {
 			bought_in_last_month INT,
 			is_best_seller BOOLEAN DEFAULT FALSE,
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			deleted_at TIMESTAMP WITH TIME ZONE
 		)`)
 		if err != nil {
 			log.Println("Error creating products table:", err)
@@ -77,32 +78,118 @@ func Initialize() {
 
 	queries := []string{
 
+		// Soft delete marker for tables created before it existed
+		"ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;",
+
+		// Every partial index below excludes soft-deleted rows. CREATE INDEX IF NOT EXISTS
+		// would keep an index created before deleted_at existed, with its old predicate,
+		// so those are dropped and rebuilt under new names. Price is NOT NULL, so one
+		// index per filter serves both directions:
+		"DROP INDEX IF EXISTS idx_products_price_asc_keyset;",
+		"DROP INDEX IF EXISTS idx_products_cat_price;",
+		"DROP INDEX IF EXISTS idx_products_brand_price;",
+		"DROP INDEX IF EXISTS idx_products_currency_price;",
+		"DROP INDEX IF EXISTS idx_products_created_keyset;",
+		"DROP INDEX IF EXISTS idx_products_price_asc_keyset_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_cat_price_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_brand_price_incl_oos;",
+
+		// Nullable sort columns list NULLs last in both directions, which a single index
+		// can't serve, so each has a DESC NULLS LAST and an ASC NULLS LAST index; a
+		// backward page scans the same index in reverse. These replace the NULLS FIRST
+		// DESC indexes of the same sort:
+		"DROP INDEX IF EXISTS idx_products_popular_keyset;",
+		"DROP INDEX IF EXISTS idx_products_rating_keyset;",
+		"DROP INDEX IF EXISTS idx_products_updated_keyset;",
+		"DROP INDEX IF EXISTS idx_products_cat_popular;",
+		"DROP INDEX IF EXISTS idx_products_cat_rating;",
+		"DROP INDEX IF EXISTS idx_products_cat_updated;",
+		"DROP INDEX IF EXISTS idx_products_brand_popular;",
+		"DROP INDEX IF EXISTS idx_products_brand_rating;",
+		"DROP INDEX IF EXISTS idx_products_brand_updated;",
+		"DROP INDEX IF EXISTS idx_products_best_seller_popular;",
+		"DROP INDEX IF EXISTS idx_products_best_seller_cat_popular;",
+		"DROP INDEX IF EXISTS idx_products_country_popular;",
+		"DROP INDEX IF EXISTS idx_products_popular_keyset_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_rating_keyset_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_updated_keyset_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_cat_popular_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_cat_rating_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_cat_updated_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_brand_popular_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_brand_rating_incl_oos;",
+		"DROP INDEX IF EXISTS idx_products_brand_updated_incl_oos;",
+
 		// Exclude Out of Stock products from indexes to optimize for common queries that filter out out-of-stock items
 
 		// Category Indexes for faster queries
-		"CREATE INDEX IF NOT EXISTS idx_products_popular_keyset ON products (bought_in_last_month DESC, id DESC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_price_asc_keyset ON products (price ASC, id ASC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_rating_keyset ON products (avg_rating DESC, id DESC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_updated_keyset ON products (updated_at DESC, id DESC) WHERE stock > 0;",
+		"CREATE INDEX IF NOT EXISTS idx_products_popular_desc_keyset ON products (bought_in_last_month DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_popular_asc_keyset ON products (bought_in_last_month ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_price_keyset ON products (price ASC, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_rating_desc_keyset ON products (avg_rating DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_rating_asc_keyset ON products (avg_rating ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_updated_desc_keyset ON products (updated_at DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_updated_asc_keyset ON products (updated_at ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
 		// Composite Indexes for category + sorting
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_popular ON products (category, bought_in_last_month DESC, id DESC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_price ON products (category, price ASC, id ASC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_rating ON products (category, avg_rating DESC, id DESC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_updated ON products (category, updated_at DESC, id DESC) WHERE stock > 0;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_popular_desc ON products (category, bought_in_last_month DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_popular_asc ON products (category, bought_in_last_month ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_price_asc ON products (category, price ASC, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_rating_desc ON products (category, avg_rating DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_rating_asc ON products (category, avg_rating ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_updated_desc ON products (category, updated_at DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_updated_asc ON products (category, updated_at ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
 		// Composite Indexes for brand + sorting
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_popular ON products (brand, bought_in_last_month DESC, id DESC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_price ON products (brand, price ASC, id ASC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_rating ON products (brand, avg_rating DESC, id DESC) WHERE stock > 0;",
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_updated ON products (brand, updated_at DESC, id DESC) WHERE stock > 0;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_popular_desc ON products (brand, bought_in_last_month DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_popular_asc ON products (brand, bought_in_last_month ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_price_asc ON products (brand, price ASC, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_rating_desc ON products (brand, avg_rating DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_rating_asc ON products (brand, avg_rating ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_updated_desc ON products (brand, updated_at DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_updated_asc ON products (brand, updated_at ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+
+		// Partial Indexes for best sellers, country / currency filters and creation date ranges
+		"CREATE INDEX IF NOT EXISTS idx_products_best_seller_popular_desc ON products (bought_in_last_month DESC NULLS LAST, id DESC) WHERE is_best_seller AND stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_best_seller_popular_asc ON products (bought_in_last_month ASC NULLS LAST, id ASC) WHERE is_best_seller AND stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_best_seller_cat_popular_desc ON products (category, bought_in_last_month DESC NULLS LAST, id DESC) WHERE is_best_seller AND stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_best_seller_cat_popular_asc ON products (category, bought_in_last_month ASC NULLS LAST, id ASC) WHERE is_best_seller AND stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_country_popular_desc ON products (country, bought_in_last_month DESC NULLS LAST, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_country_popular_asc ON products (country, bought_in_last_month ASC NULLS LAST, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_currency_price_asc ON products (currency, price ASC, id ASC) WHERE stock > 0 AND deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_created_desc_keyset ON products (created_at DESC, id DESC) WHERE stock > 0 AND deleted_at IS NULL;",
 
 		// Full Text Search Indexes for title and description
 		"CREATE EXTENSION IF NOT EXISTS pg_trgm;",
 		"CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING GIN (title gin_trgm_ops);",
 		"CREATE INDEX IF NOT EXISTS idx_products_description_trgm ON products USING GIN (description gin_trgm_ops);",
 
+		// Trigram Indexes for brand / category autocomplete
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_trgm ON products USING GIN (brand gin_trgm_ops);",
+		"CREATE INDEX IF NOT EXISTS idx_products_category_trgm ON products USING GIN (category gin_trgm_ops);",
+
 		// Text Search with search_vector
 		"CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);",
 
+		// Synonym and stop-word dictionaries, applied to the query rather than to
+		// search_vector so edits take effect without rebuilding the column
+		"CREATE TABLE IF NOT EXISTS search_synonyms (term TEXT PRIMARY KEY, synonyms TEXT[] NOT NULL, updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP);",
+		"CREATE TABLE IF NOT EXISTS search_stop_words (word TEXT PRIMARY KEY, created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP);",
+		// search_tsquery drops the stop words from the search text, parses it like
+		// websearch_to_tsquery and ORs each dictionary term with its synonyms.
+		// ts_rewrite reads the table on every call; callers evaluate it once per statement.
+		`CREATE OR REPLACE FUNCTION search_tsquery(search_text TEXT) RETURNS tsquery
+		LANGUAGE sql STABLE AS $$
+			SELECT ts_rewrite(
+				websearch_to_tsquery('english', coalesce(
+					(SELECT regexp_replace(search_text, '\m(' || string_agg(word, '|') || ')\M', ' ', 'gi') FROM search_stop_words),
+					search_text
+				)),
+				'SELECT websearch_to_tsquery(''english'', ''"'' || term || ''"''),
+					websearch_to_tsquery(''english'', ''"'' || term || ''" or "'' || array_to_string(synonyms, ''" or "'') || ''"'')
+				FROM search_synonyms
+				WHERE numnode(websearch_to_tsquery(''english'', ''"'' || term || ''"'')) > 0'
+			)
+		$$;`,
+
 		// // Full Text Search
 		// "CREATE EXTENSION pg_textsearch;",
 		// "CREATE INDEX IF NOT EXISTS products_search_idx ON product USING bm25(coalesce(title, '') || ' ' || coalesce(description, '')) WITH (text_config='english');",
@@ -110,22 +197,31 @@ func Initialize() {
 		// Include out-of-stock products in separate indexes to optimize for queries that include them
 
 		// Category Indexes for faster queries
-		"CREATE INDEX IF NOT EXISTS idx_products_popular_keyset_incl_oos ON products (bought_in_last_month DESC, id DESC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_price_asc_keyset_incl_oos ON products (price ASC, id ASC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_rating_keyset_incl_oos ON products (avg_rating DESC, id DESC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_updated_keyset_incl_oos ON products (updated_at DESC, id DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_products_popular_desc_keyset_incl_oos ON products (bought_in_last_month DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_popular_asc_keyset_incl_oos ON products (bought_in_last_month ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_price_keyset_incl_oos ON products (price ASC, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_rating_desc_keyset_incl_oos ON products (avg_rating DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_rating_asc_keyset_incl_oos ON products (avg_rating ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_updated_desc_keyset_incl_oos ON products (updated_at DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_updated_asc_keyset_incl_oos ON products (updated_at ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
 
 		// Composite Indexes for category + sorting
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_popular_incl_oos ON products (category, bought_in_last_month DESC, id DESC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_price_incl_oos ON products (category, price ASC, id ASC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_rating_incl_oos ON products (category, avg_rating DESC, id DESC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_cat_updated_incl_oos ON products (category, updated_at DESC, id DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_popular_desc_incl_oos ON products (category, bought_in_last_month DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_popular_asc_incl_oos ON products (category, bought_in_last_month ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_price_asc_incl_oos ON products (category, price ASC, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_rating_desc_incl_oos ON products (category, avg_rating DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_rating_asc_incl_oos ON products (category, avg_rating ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_updated_desc_incl_oos ON products (category, updated_at DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_cat_updated_asc_incl_oos ON products (category, updated_at ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
 
 		// Composite Indexes for brand + sorting
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_popular_incl_oos ON products (brand, bought_in_last_month DESC, id DESC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_price_incl_oos ON products (brand, price ASC, id ASC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_rating_incl_oos ON products (brand, avg_rating DESC, id DESC);",
-		"CREATE INDEX IF NOT EXISTS idx_products_brand_updated_incl_oos ON products (brand, updated_at DESC, id DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_popular_desc_incl_oos ON products (brand, bought_in_last_month DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_popular_asc_incl_oos ON products (brand, bought_in_last_month ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_price_asc_incl_oos ON products (brand, price ASC, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_rating_desc_incl_oos ON products (brand, avg_rating DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_rating_asc_incl_oos ON products (brand, avg_rating ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_updated_desc_incl_oos ON products (brand, updated_at DESC NULLS LAST, id DESC) WHERE deleted_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_products_brand_updated_asc_incl_oos ON products (brand, updated_at ASC NULLS LAST, id ASC) WHERE deleted_at IS NULL;",
 	}
 
 	for _, query := range queries {
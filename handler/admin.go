@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"ecommerce_product_listing/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminOnly guards a route with the X-Admin-Key header. Admin routes are closed
+// entirely when ADMIN_API_KEY is not configured.
+func (h *ProductHandler) AdminOnly(c *fiber.Ctx) error {
+	key := config.AdminAPIKey()
+	if key == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "admin endpoints are disabled",
+		})
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Get("X-Admin-Key")), []byte(key)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid admin key",
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitBody buffers the request body, rejecting it with 413 past limit bytes. The app
+// streams request bodies for imports, and a streamed body skips fiber's BodyLimit:
+// c.Body() would read all of it. Routes that parse the whole body need this in front.
+func (h *ProductHandler) LimitBody(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stream := c.Context().RequestBodyStream()
+		if stream == nil {
+			return c.Next()
+		}
+
+		body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > limit {
+			return fiber.ErrRequestEntityTooLarge
+		}
+
+		// Replaces the stream, so c.Body() returns the buffered copy
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+}
@@ -1,10 +1,19 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"ecommerce_product_listing/codec"
+	"ecommerce_product_listing/config"
 	"ecommerce_product_listing/models"
+	"ecommerce_product_listing/pagination"
+	"ecommerce_product_listing/repository"
 	"ecommerce_product_listing/service"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -41,7 +50,28 @@ func (h *ProductHandler) AddProduct(c *fiber.Ctx) error {
 		product.UpdatedAt = &now
 	}
 
+	if c.Query("mode") == "upsert" {
+		opts, err := models.NewUpsertOptions(c.Query("update_fields"))
+		if err != nil {
+			return validationResponse(c, err)
+		}
+
+		result, err := h.Service.UpsertProduct(context.Background(), &product, opts)
+		if err != nil {
+			return upsertErrorResponse(c, err)
+		}
+
+		status := fiber.StatusOK
+		if result.Status == models.WriteCreated {
+			status = fiber.StatusCreated
+		}
+		return c.Status(status).JSON(result)
+	}
+
 	result, err := h.Service.AddProduct(context.Background(), &product)
+	if errors.Is(err, repository.ErrDuplicateASIN) {
+		return duplicateASINResponse(c)
+	}
 	if err != nil {
 		log.Error("Failed to create product:", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -80,6 +110,40 @@ func (h *ProductHandler) AddProductsBulk(c *fiber.Ctx) error {
 		}
 	}
 
+	if c.QueryBool("partial") {
+		var opts *models.UpsertOptions
+		if c.Query("mode") == "upsert" {
+			var err error
+			if opts, err = models.NewUpsertOptions(c.Query("update_fields")); err != nil {
+				return validationResponse(c, err)
+			}
+		}
+
+		result, err := h.Service.AddProductsPartial(context.Background(), products, opts)
+		if err != nil {
+			log.Error("Failed to insert products:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to insert products",
+			})
+		}
+
+		return c.Status(fiber.StatusMultiStatus).JSON(result)
+	}
+
+	if c.Query("mode") == "upsert" {
+		opts, err := models.NewUpsertOptions(c.Query("update_fields"))
+		if err != nil {
+			return validationResponse(c, err)
+		}
+
+		results, err := h.Service.UpsertProductsBulk(context.Background(), products, opts)
+		if err != nil {
+			return upsertErrorResponse(c, err)
+		}
+
+		return c.JSON(results)
+	}
+
 	result, err := h.Service.AddProductsBulk(context.Background(), products)
 	if err != nil {
 		log.Error("Failed to insert products:", err)
@@ -106,8 +170,75 @@ func (h *ProductHandler) GetProducts(c *fiber.Ctx) error {
 			"error_message": err.Error(),
 		})
 	}
+
+	if err := productFilter.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid filter",
+			"error_message": err.Error(),
+		})
+	}
+
+	interpretation, err := h.Service.InterpretQuery(c.Context(), productFilter)
+	if err != nil {
+		log.Error("Failed to interpret search query:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to interpret search query",
+		})
+	}
+
+	return h.listResponse(c, productFilter, interpretation)
+}
+
+// SearchProducts lists products matching a JSON filter tree; it pages and responds
+// like GetProducts.
+func (h *ProductHandler) SearchProducts(c *fiber.Ctx) error {
+
+	var request models.SearchRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid request body",
+			"error_message": err.Error(),
+		})
+	}
+
+	productFilter := request.ProductFilter()
+
+	if err := productFilter.Validate(); err != nil {
+		response := fiber.Map{
+			"error":         "invalid filter",
+			"error_message": err.Error(),
+		}
+		// Points at the offending node, e.g. filter.and[1].range.lt
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			response["field"] = validationErr.Field
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	return h.listResponse(c, productFilter, nil)
+}
+
+// listResponse applies the filter's cursor and renders one page of the listing,
+// with the search query's interpretation when there is one.
+func (h *ProductHandler) listResponse(
+	c *fiber.Ctx,
+	productFilter *models.ProductFilter,
+	interpretation *models.QueryInterpretation,
+) error {
+
+	if productFilter.Cursor != "" {
+		productFilter.Normalize()
+		if err := pagination.Apply(productFilter, productFilter.Cursor); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":         "invalid cursor",
+				"error_message": "cursor does not match this query's sort and filters",
+			})
+		}
+	}
 	log.Info("Parsed product filter:", fmt.Sprintf("%+v", productFilter))
-	products, err := h.Service.ListProducts(
+	products, hasMore, err := h.Service.ListProducts(
 		c.Context(), // fasthttp context
 		productFilter,
 	)
@@ -119,38 +250,30 @@ func (h *ProductHandler) GetProducts(c *fiber.Ctx) error {
 		})
 	}
 
-	count := len(products)
+	response := fiber.Map{
+		"count":       len(products),
+		"has_more":    hasMore,
+		"next_cursor": pagination.Next(productFilter, products, hasMore),
+		"prev_cursor": pagination.Prev(productFilter, products, hasMore),
+		"products":    products,
+	}
 
-	var lastID int
-	var sortLastValue interface{}
+	if interpretation != nil {
+		response["interpretation"] = interpretation
+	}
 
-	if count > 0 {
-		lastID = products[count-1].ID
-		if string(productFilter.SortByColumn) != "" {
-			product := products[count-1]
-			switch productFilter.SortByColumn {
-			case models.SortByPrice:
-				sortLastValue = fmt.Sprintf("%f", product.Price)
-			case models.SortByPopularity:
-				sortLastValue = fmt.Sprintf("%d", product.BoughtInLastMonth)
-			case models.SortByRating:
-				sortLastValue = fmt.Sprintf("%f", product.AvgRating)
-			case models.SortByModificationDate:
-				sortLastValue = product.UpdatedAt.Format(time.RFC3339Nano)
-			default:
-				sortLastValue = nil
-			}
+	if productFilter.IncludeFacets {
+		facets, err := h.Service.GetFacets(c.Context(), productFilter)
+		if err != nil {
+			log.Error("Failed to fetch facets:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to fetch facets",
+			})
 		}
+		response["facets"] = facets
 	}
 
-	return c.JSON(fiber.Map{
-		"count":           len(products),
-		"last_id":         lastID,
-		"sort_order":      productFilter.SortOrder,
-		"sort_last_value": sortLastValue,
-		"sort_by_column":  productFilter.SortByColumn,
-		"products":        products,
-	})
+	return c.JSON(response)
 }
 
 func (h *ProductHandler) GetCounts(c *fiber.Ctx) error {
@@ -169,6 +292,20 @@ func (h *ProductHandler) GetCounts(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := productFilter.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid filter",
+			"error_message": err.Error(),
+		})
+	}
+
+	if _, err := h.Service.InterpretQuery(c.Context(), productFilter); err != nil {
+		log.Error("Failed to interpret search query:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to interpret search query",
+		})
+	}
+
 	count, err := h.Service.GetCounts(c.Context(), productFilter)
 	if err != nil {
 		log.Error("Failed to fetch counts:", err)
@@ -177,7 +314,465 @@ func (h *ProductHandler) GetCounts(c *fiber.Ctx) error {
 		})
 	}
 
+	return c.JSON(count)
+}
+
+func (h *ProductHandler) GetFacets(c *fiber.Ctx) error {
+
+	productFilter := models.NewProductFilter()
+
+	if err := c.QueryParser(productFilter); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid request body",
+			"error_message": err.Error(),
+		})
+	}
+
+	if err := productFilter.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid filter",
+			"error_message": err.Error(),
+		})
+	}
+
+	if _, err := h.Service.InterpretQuery(c.Context(), productFilter); err != nil {
+		log.Error("Failed to interpret search query:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to interpret search query",
+		})
+	}
+
+	facets, err := h.Service.GetFacets(c.Context(), productFilter)
+	if err != nil {
+		log.Error("Failed to fetch facets:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch facets",
+		})
+	}
+
 	return c.JSON(fiber.Map{
-		"count": count,
+		"facets": facets,
 	})
 }
+
+func (h *ProductHandler) GetSuggestions(c *fiber.Ctx) error {
+
+	prefix := strings.TrimSpace(c.Query("q"))
+
+	limit := c.QueryInt("limit", models.DefaultSuggestLimit)
+	if limit <= 0 || limit > models.MaxSuggestLimit {
+		limit = models.DefaultSuggestLimit
+	}
+
+	// Too short to narrow anything down; answer without touching the DB
+	if len([]rune(prefix)) < models.MinSuggestQueryChars {
+		return c.JSON(models.Suggestions{
+			Titles:     []string{},
+			Brands:     []string{},
+			Categories: []string{},
+		})
+	}
+
+	suggestions, err := h.Service.Suggest(c.Context(), prefix, limit)
+	if err != nil {
+		log.Error("Failed to fetch suggestions:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch suggestions",
+		})
+	}
+
+	return c.JSON(suggestions)
+}
+
+func (h *ProductHandler) GetProduct(c *fiber.Ctx) error {
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid product id",
+		})
+	}
+
+	product, err := h.Service.GetProductByID(c.Context(), id)
+	return h.productResponse(c, product, err)
+}
+
+func (h *ProductHandler) GetProductByASIN(c *fiber.Ctx) error {
+
+	asin := strings.TrimSpace(c.Params("asin"))
+	if asin == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid asin",
+		})
+	}
+
+	product, err := h.Service.GetProductByASIN(c.Context(), asin)
+	return h.productResponse(c, product, err)
+}
+
+// productResponse renders a single-product lookup, mapping a missing row to 404.
+func (h *ProductHandler) productResponse(c *fiber.Ctx, product *models.Product, err error) error {
+	if errors.Is(err, repository.ErrProductNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "product not found",
+		})
+	}
+	if err != nil {
+		log.Error("Failed to fetch product:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch product",
+		})
+	}
+
+	return c.JSON(product)
+}
+
+func (h *ProductHandler) UpdateProduct(c *fiber.Ctx) error {
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid product id",
+		})
+	}
+
+	var product models.Product
+
+	if err := c.BodyParser(&product); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	result, err := h.Service.UpdateProduct(c.Context(), id, &product)
+	return h.updateResponse(c, result, err)
+}
+
+func (h *ProductHandler) PatchProduct(c *fiber.Ctx) error {
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid product id",
+		})
+	}
+
+	result, err := h.Service.PatchProduct(c.Context(), id, c.Body())
+	return h.updateResponse(c, result, err)
+}
+
+// validationResponse renders a *models.ValidationError as a 400 and any other error
+// as a 500.
+func validationResponse(c *fiber.Ctx, err error) error {
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		log.Error("Failed to process product:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to process product",
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":         "invalid product",
+		"error_message": validationErr.Error(),
+		"field":         validationErr.Field,
+	})
+}
+
+// duplicateASINResponse renders a write that would reuse another product's ASIN as a 409.
+func duplicateASINResponse(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error": "a product with this asin already exists",
+		"field": "asin",
+	})
+}
+
+func upsertErrorResponse(c *fiber.Ctx, err error) error {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationResponse(c, err)
+	}
+	var rowErrs *models.RowValidationErrors
+	if errors.As(err, &rowErrs) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "invalid products",
+			"errors": rowErrs.Errors,
+		})
+	}
+
+	log.Error("Failed to upsert products:", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "failed to upsert products",
+	})
+}
+
+// updateResponse renders the outcome of a PUT or PATCH.
+func (h *ProductHandler) updateResponse(c *fiber.Ctx, product *models.Product, err error) error {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationResponse(c, err)
+	}
+	if errors.Is(err, repository.ErrProductNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "product not found",
+		})
+	}
+	if errors.Is(err, repository.ErrDuplicateASIN) {
+		return duplicateASINResponse(c)
+	}
+	if err != nil {
+		log.Error("Failed to update product:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update product",
+		})
+	}
+
+	return c.JSON(product)
+}
+
+func (h *ProductHandler) DeleteProduct(c *fiber.Ctx) error {
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid product id",
+		})
+	}
+
+	err = h.Service.DeleteProduct(c.Context(), id)
+	return h.deleteResponse(c, err)
+}
+
+func (h *ProductHandler) RestoreProduct(c *fiber.Ctx) error {
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid product id",
+		})
+	}
+
+	product, err := h.Service.RestoreProduct(c.Context(), id)
+	if errors.Is(err, repository.ErrProductNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "deleted product not found",
+		})
+	}
+	if err != nil {
+		log.Error("Failed to restore product:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to restore product",
+		})
+	}
+
+	return c.JSON(product)
+}
+
+func (h *ProductHandler) PurgeProduct(c *fiber.Ctx) error {
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid product id",
+		})
+	}
+
+	err = h.Service.PurgeProduct(c.Context(), id)
+	return h.deleteResponse(c, err)
+}
+
+func (h *ProductHandler) deleteResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, repository.ErrProductNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "product not found",
+		})
+	}
+	if err != nil {
+		log.Error("Failed to delete product:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete product",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ImportProducts streams an NDJSON or CSV body into products via COPY. Existing
+// ASINs are updated unless on_conflict=skip.
+func (h *ProductHandler) ImportProducts(c *fiber.Ctx) error {
+
+	formatValue := c.Query("format")
+	if formatValue == "" {
+		formatValue = c.Get(fiber.HeaderContentType)
+	}
+	format, err := codec.ParseFormat(formatValue)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid format",
+			"error_message": err.Error(),
+		})
+	}
+
+	var opts *models.UpsertOptions
+	if c.Query("on_conflict") != "skip" {
+		if opts, err = models.NewUpsertOptions(c.Query("update_fields")); err != nil {
+			return validationResponse(c, err)
+		}
+	}
+
+	// With StreamRequestBody the body is read as COPY consumes it
+	body := c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	src, err := codec.NewProductSource(format, body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid request body",
+			"error_message": err.Error(),
+		})
+	}
+
+	result, err := h.Service.ImportProducts(c.Context(), src, opts)
+	if errors.Is(err, repository.ErrImportDecode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid request body",
+			"error_message": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Error("Failed to import products:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to import products",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// ExportProducts streams every product matching the filter as NDJSON or CSV.
+func (h *ProductHandler) ExportProducts(c *fiber.Ctx) error {
+
+	productFilter := models.NewProductFilter()
+
+	if err := c.QueryParser(productFilter); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid request body",
+			"error_message": err.Error(),
+		})
+	}
+
+	if err := productFilter.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid filter",
+			"error_message": err.Error(),
+		})
+	}
+
+	format, err := codec.ParseFormat(c.Query("format"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid format",
+			"error_message": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="products.%s"`, format))
+
+	return h.streamProducts(c, productFilter, func(w io.Writer) (codec.ProductWriter, error) {
+		return codec.NewProductWriter(format, w)
+	})
+}
+
+// GetFeed streams the catalog as a Google Merchant Center RSS feed or a Facebook
+// catalog CSV. Out-of-stock products are included, flagged through availability.
+func (h *ProductHandler) GetFeed(c *fiber.Ctx) error {
+
+	productFilter := models.NewProductFilter()
+	productFilter.ShowOutOfStock = true
+
+	if err := c.QueryParser(productFilter); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid request body",
+			"error_message": err.Error(),
+		})
+	}
+
+	if err := productFilter.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid filter",
+			"error_message": err.Error(),
+		})
+	}
+
+	format, err := codec.ParseFeedFormat(c.Query("format"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid format",
+			"error_message": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="feed.%s"`, format.Extension()))
+
+	channel := codec.FeedChannel{
+		Title:       config.FeedTitle(),
+		Link:        config.FeedLink(),
+		Description: config.FeedDescription(),
+	}
+	return h.streamProducts(c, productFilter, func(w io.Writer) (codec.ProductWriter, error) {
+		return codec.NewFeedWriter(format, w, channel)
+	})
+}
+
+// streamProducts writes every product matching the filter through the writer
+// newWriter builds. The stream writer runs after the handler returns, so it can't
+// report errors through the status code; failures are logged and end the stream early.
+func (h *ProductHandler) streamProducts(
+	c *fiber.Ctx,
+	productFilter *models.ProductFilter,
+	newWriter func(w io.Writer) (codec.ProductWriter, error),
+) error {
+
+	if _, err := h.Service.InterpretQuery(c.Context(), productFilter); err != nil {
+		log.Error("Failed to interpret search query:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to interpret search query",
+		})
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		writer, err := newWriter(w)
+		if err != nil {
+			log.Error("Failed to start export:", err)
+			return
+		}
+
+		written := 0
+		err = h.Service.ExportProducts(context.Background(), productFilter, func(p *models.Product) error {
+			if err := writer.Write(p); err != nil {
+				return err
+			}
+			written++
+			if written%1000 == 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+				return w.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error("Export aborted:", err)
+		}
+
+		if err := writer.Close(); err != nil {
+			log.Error("Failed to finish export:", err)
+		}
+		log.Info("Exported products:", written)
+	})
+
+	return nil
+}
@@ -0,0 +1,598 @@
+package handler
+
+import (
+	"context"
+	"ecommerce_product_listing/codec"
+	"ecommerce_product_listing/models"
+	"ecommerce_product_listing/repository"
+	"ecommerce_product_listing/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// newTestApp serves the listing, search, write and admin routes over a memory store
+// seeded with a small catalog.
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+
+	repo := repository.NewMemoryProductRepository()
+	_, err := repo.CreateProductsBulk(context.Background(), []models.Product{
+		{Title: "Wireless Headphones", ASIN: "B001", Description: "Noise cancelling over-ear headphones", Category: "Electronics", Brand: "Sony", Price: 199, Currency: "USD", Stock: 10, AvgRating: ptr(4.6), BoughtInLastMonth: ptr(900)},
+		{Title: "Wired Earbuds", ASIN: "B002", Description: "In-ear earbuds with microphone", Category: "Electronics", Brand: "Sony", Price: 29, Currency: "USD", Stock: 50, AvgRating: ptr(4.1), BoughtInLastMonth: ptr(1500)},
+		{Title: "Bluetooth Speaker", ASIN: "B003", Description: "Portable wireless speaker", Category: "Electronics", Brand: "JBL", Price: 99, Currency: "USD", Stock: 5, BoughtInLastMonth: ptr(300)},
+		{Title: "Running Shoes", ASIN: "B004", Description: "Lightweight trainers", Category: "Sports", Brand: "Nike", Price: 120, Currency: "USD", Stock: 20, AvgRating: ptr(4.4)},
+		{Title: "Coffee Maker", ASIN: "B005", Description: "Drip coffee maker with timer", Category: "Kitchen", Brand: "Breville", Price: 89, Currency: "USD", Stock: 7, AvgRating: ptr(3.9), BoughtInLastMonth: ptr(300)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ProductHandler{Service: &service.ProductService{Repo: repo}}
+
+	app := fiber.New()
+	products := app.Group("/api/v1/products")
+	products.Get("/", h.GetProducts)
+	products.Get("/counts", h.GetCounts)
+	products.Get("/export", h.ExportProducts)
+	products.Get("/feed", h.GetFeed)
+	products.Post("/search", h.SearchProducts)
+	products.Post("/", h.AddProduct)
+	products.Post("/bulk", h.AddProductsBulk)
+	products.Put("/:id<int>", h.UpdateProduct)
+	products.Patch("/:id<int>", h.PatchProduct)
+
+	admin := app.Group("/api/v1/admin", h.AdminOnly)
+	admin.Put("/synonyms/:term", h.PutSynonym)
+	admin.Get("/stop-words", h.GetStopWords)
+	admin.Put("/stop-words/:word", h.PutStopWord)
+	admin.Delete("/stop-words/:word", h.DeleteStopWord)
+
+	return app
+}
+
+type listBody struct {
+	Count      int              `json:"count"`
+	HasMore    bool             `json:"has_more"`
+	NextCursor string           `json:"next_cursor"`
+	PrevCursor string           `json:"prev_cursor"`
+	Products   []models.Product `json:"products"`
+	Error      string           `json:"error"`
+	Field      string           `json:"field"`
+}
+
+func doRequest(t *testing.T, app *fiber.App, req *http.Request, out interface{}) int {
+	t.Helper()
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return resp.StatusCode
+}
+
+func getList(t *testing.T, app *fiber.App, query url.Values) (int, listBody) {
+	t.Helper()
+
+	var body listBody
+	status := doRequest(t, app, httptest.NewRequest(http.MethodGet, "/api/v1/products?"+query.Encode(), nil), &body)
+	return status, body
+}
+
+func postSearch(t *testing.T, app *fiber.App, request string) (int, listBody) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/products/search", strings.NewReader(request))
+	req.Header.Set("Content-Type", "application/json")
+	var body listBody
+	status := doRequest(t, app, req, &body)
+	return status, body
+}
+
+func ids(products []models.Product) []int {
+	out := make([]int, len(products))
+	for i, p := range products {
+		out[i] = p.ID
+	}
+	return out
+}
+
+func TestGetProductsCursorPaging(t *testing.T) {
+	app := newTestApp(t)
+
+	query := url.Values{"sort_by_column": {"avg_rating"}, "sort_order": {"asc"}, "page_size": {"2"}}
+
+	var seen []int
+	var cursors []string
+	for cursor := ""; ; {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+
+		status, body := getList(t, app, q)
+		if status != fiber.StatusOK {
+			t.Fatalf("status %d: %s", status, body.Error)
+		}
+		seen = append(seen, ids(body.Products)...)
+		cursors = append(cursors, body.PrevCursor)
+		if !body.HasMore {
+			break
+		}
+		cursor = body.NextCursor
+	}
+
+	// Unrated product 3 comes last in ascending order too
+	if want := []int{5, 2, 4, 1, 3}; !slices.Equal(seen, want) {
+		t.Fatalf("ids = %v, want %v", seen, want)
+	}
+	if cursors[0] != "" {
+		t.Errorf("first page has prev_cursor %q", cursors[0])
+	}
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("cursor", cursors[len(cursors)-1])
+	status, body := getList(t, app, q)
+	if status != fiber.StatusOK {
+		t.Fatalf("status %d: %s", status, body.Error)
+	}
+	if want := []int{4, 1}; !slices.Equal(ids(body.Products), want) {
+		t.Errorf("prev page ids = %v, want %v", ids(body.Products), want)
+	}
+}
+
+func TestGetProductsRejectsForeignCursor(t *testing.T) {
+	app := newTestApp(t)
+
+	_, first := getList(t, app, url.Values{"page_size": {"2"}})
+	if first.NextCursor == "" {
+		t.Fatal("no next_cursor on the first page")
+	}
+
+	status, _ := getList(t, app, url.Values{"page_size": {"2"}, "category": {"Electronics"}, "cursor": {first.NextCursor}})
+	if status != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want 400", status)
+	}
+}
+
+func TestGetCounts(t *testing.T) {
+	app := newTestApp(t)
+
+	var count models.Count
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/products/counts?category=Electronics&count_mode=capped&count_cap=2", nil)
+	if status := doRequest(t, app, req, &count); status != fiber.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if count.Count != 2 || !count.Capped || count.Display != "2+" {
+		t.Errorf("count = %+v, want capped at 2", count)
+	}
+}
+
+func TestSearchProducts(t *testing.T) {
+	app := newTestApp(t)
+
+	status, body := postSearch(t, app, `{
+		"sort_by_column": "price",
+		"sort_order": "asc",
+		"filter": {"and": [
+			{"eq": {"field": "category", "value": "Electronics"}},
+			{"not": {"match": {"query": "earbuds"}}}
+		]}
+	}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("status %d: %s", status, body.Error)
+	}
+	if want := []int{3, 1}; !slices.Equal(ids(body.Products), want) {
+		t.Errorf("ids = %v, want %v", ids(body.Products), want)
+	}
+}
+
+func TestSearchProductsInvalidFilter(t *testing.T) {
+	app := newTestApp(t)
+
+	status, body := postSearch(t, app, `{"filter": {"and": [
+		{"eq": {"field": "brand", "value": "Sony"}},
+		{"range": {"field": "price", "lt": "cheap"}}
+	]}}`)
+	if status != fiber.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", status)
+	}
+	if body.Field != "filter.and[1].range.lt" {
+		t.Errorf("field = %q, want filter.and[1].range.lt", body.Field)
+	}
+}
+
+func TestSynonymsApplyToSearch(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "test-key")
+	app := newTestApp(t)
+
+	search := url.Values{"search_type": {"fts"}, "search_query_text": {"sneakers"}}
+	if _, body := getList(t, app, search); len(body.Products) != 0 {
+		t.Fatalf("ids before synonym = %v", ids(body.Products))
+	}
+
+	put := func(key string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/synonyms/sneakers", strings.NewReader(`{"synonyms": ["trainers"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Key", key)
+		var out map[string]interface{}
+		return doRequest(t, app, req, &out)
+	}
+	if status := put("wrong"); status != fiber.StatusUnauthorized {
+		t.Fatalf("status with wrong key = %d, want 401", status)
+	}
+	if status := put("test-key"); status != fiber.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+
+	if _, body := getList(t, app, search); !slices.Equal(ids(body.Products), []int{4}) {
+		t.Errorf("ids with synonym = %v, want [4]", ids(body.Products))
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	h := &ProductHandler{}
+
+	// Bodies over BodyLimit reach handlers as a stream when streaming is on
+	app := fiber.New(fiber.Config{StreamRequestBody: true, BodyLimit: 16})
+	app.Post("/stream", func(c *fiber.Ctx) error {
+		n, err := io.Copy(io.Discard, c.Context().RequestBodyStream())
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"read": n})
+	})
+	app.Use(h.LimitBody(64))
+	app.Post("/buffered", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"read": len(c.Body())})
+	})
+
+	tests := []struct {
+		path   string
+		size   int
+		status int
+	}{
+		{"/buffered", 10, fiber.StatusOK},
+		{"/buffered", 64, fiber.StatusOK},
+		{"/buffered", 65, fiber.StatusRequestEntityTooLarge},
+		{"/buffered", 1 << 20, fiber.StatusRequestEntityTooLarge},
+		{"/stream", 1 << 20, fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+		// The rejected body is left unread, so the connection can't be reused
+		req.Header.Set("Connection", "close")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s with %d bytes: %v", tt.path, tt.size, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s with %d bytes: status = %d, want %d", tt.path, tt.size, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != fiber.StatusOK {
+			continue
+		}
+		var body struct {
+			Read int `json:"read"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Read != tt.size {
+			t.Errorf("%s read %d bytes, want %d", tt.path, body.Read, tt.size)
+		}
+	}
+}
+
+func TestImportProductsReportsUndecodableLines(t *testing.T) {
+	h := &ProductHandler{Service: &service.ProductService{Repo: repository.NewMemoryProductRepository()}}
+	app := fiber.New(fiber.Config{StreamRequestBody: true})
+	app.Post("/import", h.ImportProducts)
+
+	tests := []struct {
+		format string
+		body   string
+		want   []models.ImportRowError
+	}{
+		{"ndjson", strings.Join([]string{
+			`{"title": "Desk Lamp", "asin": "L1", "price": 30, "currency": "USD", "stock": 4}`,
+			`{"title": "Broken", "price": `,
+			`{"title": "Wrong Type", "asin": "L3", "price": "cheap", "currency": "USD"}`,
+			`{"title": "Floor Lamp", "asin": "L4", "price": 80, "currency": "USD", "stock": 2}`,
+		}, "\n"), []models.ImportRowError{{Line: 2}, {Line: 3, Field: "price"}}},
+		{"csv", strings.Join([]string{
+			"title,asin,price,currency,stock",
+			"Desk Lamp,C1,30,USD,4",
+			"Wrong Type,C2,cheap,USD,1",
+			`Bad "Quote,C3,10,USD,1`,
+			"Floor Lamp,C4,80,USD,2",
+		}, "\n"), []models.ImportRowError{{Line: 3, Field: "price"}, {Line: 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/import?format="+tt.format, strings.NewReader(tt.body))
+			var result models.ImportResult
+			if status := doRequest(t, app, req, &result); status != fiber.StatusOK {
+				t.Fatalf("status = %d, result %+v", status, result)
+			}
+
+			if result.Received != 4 || result.Inserted != 2 || result.Invalid != 2 {
+				t.Errorf("result = %+v, want 4 received, 2 inserted, 2 invalid", result)
+			}
+			if len(result.Errors) != len(tt.want) {
+				t.Fatalf("errors = %+v, want %d", result.Errors, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := result.Errors[i]
+				if got.Line != want.Line || got.Field != want.Field || got.Message == "" {
+					t.Errorf("errors[%d] = %+v, want line %d field %q", i, got, want.Line, want.Field)
+				}
+			}
+		})
+	}
+}
+
+func sendProduct(t *testing.T, app *fiber.App, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	var out map[string]interface{}
+	status := doRequest(t, app, req, &out)
+	return status, out
+}
+
+func TestPatchProductNulls(t *testing.T) {
+	app := newTestApp(t)
+
+	status, out := sendProduct(t, app, http.MethodPatch, "/api/v1/products/1", `{"description": null, "avg_rating": null, "stock": 3}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", status, out)
+	}
+	if _, ok := out["description"]; ok {
+		t.Errorf("description = %v, want it cleared", out["description"])
+	}
+	if _, ok := out["avg_rating"]; ok {
+		t.Errorf("avg_rating = %v, want it cleared", out["avg_rating"])
+	}
+	if out["stock"] != float64(3) || out["bought_in_last_month"] != float64(900) {
+		t.Errorf("stock %v bought_in_last_month %v, want 3 and 900 kept", out["stock"], out["bought_in_last_month"])
+	}
+
+	status, out = sendProduct(t, app, http.MethodPatch, "/api/v1/products/1", `{"price": null}`)
+	if status != fiber.StatusBadRequest || out["field"] != "price" {
+		t.Errorf("null price: status = %d, body %v", status, out)
+	}
+}
+
+func TestWriteDuplicateASIN(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"create", http.MethodPost, "/api/v1/products/", `{"title": "Copy", "asin": "B002", "price": 5, "currency": "USD"}`},
+		{"update", http.MethodPut, "/api/v1/products/1", `{"title": "Copy", "asin": "B002", "price": 5, "currency": "USD"}`},
+		{"patch", http.MethodPatch, "/api/v1/products/1", `{"asin": "B002"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, out := sendProduct(t, app, tt.method, tt.path, tt.body)
+			if status != fiber.StatusConflict || out["field"] != "asin" {
+				t.Errorf("status = %d, body %v", status, out)
+			}
+		})
+	}
+}
+
+func TestAddProductsBulkPartial(t *testing.T) {
+	app := newTestApp(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/products/bulk?partial=true", strings.NewReader(`[
+		{"title": "Phone Case", "price": 15, "currency": "USD", "stock": 4},
+		{"title": "Screen Protector", "price": 9, "currency": "USD", "stock": 8},
+		{"title": "Charger", "price": 0, "currency": "USD"},
+		{"title": "Headphones Copy", "asin": "B001", "price": 50, "currency": "USD"},
+		{"title": "Tripod", "asin": "B100", "price": 40, "currency": "USD"}
+	]`))
+	req.Header.Set("Content-Type", "application/json")
+	var result models.BulkResult
+	if status := doRequest(t, app, req, &result); status != fiber.StatusMultiStatus {
+		t.Fatalf("status = %d, body %+v", status, result)
+	}
+
+	if result.Created != 3 || result.Failed != 2 {
+		t.Errorf("created %d failed %d, want 3 and 2", result.Created, result.Failed)
+	}
+	want := []struct {
+		status    models.WriteStatus
+		errorType models.ItemErrorType
+		field     string
+	}{
+		{models.WriteCreated, "", ""},
+		{models.WriteCreated, "", ""}, // no ASIN either, and no clash with row 0
+		{models.WriteFailed, models.ItemErrorValidation, "price"},
+		{models.WriteFailed, models.ItemErrorDuplicateASIN, "asin"},
+		{models.WriteCreated, "", ""},
+	}
+	if len(result.Items) != len(want) {
+		t.Fatalf("items = %+v", result.Items)
+	}
+	for i, item := range result.Items {
+		var errorType models.ItemErrorType
+		var field string
+		if item.Error != nil {
+			errorType, field = item.Error.Type, item.Error.Field
+		}
+		if item.Index != i || item.Status != want[i].status || errorType != want[i].errorType || field != want[i].field {
+			t.Errorf("item %d = %+v (error %+v), want %+v", i, item, item.Error, want[i])
+		}
+	}
+}
+
+func TestValidationResponse(t *testing.T) {
+	app := fiber.New()
+	app.Get("/invalid", func(c *fiber.Ctx) error {
+		return validationResponse(c, fmt.Errorf("row 2: %w", &models.ValidationError{Field: "price", Message: "must be greater than 0"}))
+	})
+	app.Get("/failed", func(c *fiber.Ctx) error {
+		return validationResponse(c, errors.New("connection reset"))
+	})
+
+	var out map[string]interface{}
+	if status := doRequest(t, app, httptest.NewRequest(http.MethodGet, "/invalid", nil), &out); status != fiber.StatusBadRequest || out["field"] != "price" {
+		t.Errorf("validation error: status = %d, body %v", status, out)
+	}
+	if status := doRequest(t, app, httptest.NewRequest(http.MethodGet, "/failed", nil), &out); status != fiber.StatusInternalServerError {
+		t.Errorf("other error: status = %d, body %v", status, out)
+	}
+}
+
+func TestStopWordsPercentEncoded(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+	app := newTestApp(t)
+
+	admin := func(method string) *http.Request {
+		req := httptest.NewRequest(method, "/api/v1/admin/stop-words/%C3%BCber", nil)
+		req.Header.Set("X-Admin-Key", "secret")
+		return req
+	}
+
+	var stopWord models.StopWord
+	if status := doRequest(t, app, admin(http.MethodPut), &stopWord); status != fiber.StatusOK || stopWord.Word != "über" {
+		t.Fatalf("put: status = %d, word %q", status, stopWord.Word)
+	}
+
+	resp, err := app.Test(admin(http.MethodDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("delete: status = %d, want 204", resp.StatusCode)
+	}
+}
+
+func TestExportProducts(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, format := range []codec.Format{codec.FormatCSV, codec.FormatNDJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			query := url.Values{"format": {string(format)}, "category": {"Electronics"}, "sort_by": {"price"}, "sort_order": {"asc"}}
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/products/export?"+query.Encode(), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != fiber.StatusOK || resp.Header.Get(fiber.HeaderContentType) != format.ContentType() {
+				t.Fatalf("status %d content type %q", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+			}
+
+			src, err := codec.NewProductSource(format, resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for {
+				p, _, err := src.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := p.Validate(); err != nil {
+					t.Errorf("exported %q does not re-import: %v", p.Title, err)
+				}
+				titles = append(titles, p.Title)
+			}
+
+			// Export ignores sort and paging: every match, in id order
+			want := []string{"Wireless Headphones", "Wired Earbuds", "Bluetooth Speaker"}
+			if !slices.Equal(titles, want) {
+				t.Errorf("titles = %v, want %v", titles, want)
+			}
+		})
+	}
+}
+
+func TestGetFeed(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		format      string
+		contentType string
+		lines       int
+	}{
+		{"google", "application/rss+xml; charset=utf-8", 0},
+		{"facebook", "text/csv; charset=utf-8", 3}, // header and the two Sony products
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			query := url.Values{"format": {tt.format}, "brand": {"Sony"}}
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/products/feed?"+query.Encode(), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != fiber.StatusOK || resp.Header.Get(fiber.HeaderContentType) != tt.contentType {
+				t.Fatalf("status %d content type %q", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+			}
+			if strings.Count(string(body), "Sony") != 2 || strings.Contains(string(body), "JBL") {
+				t.Errorf("feed does not hold exactly the Sony products:\n%s", body)
+			}
+			if tt.lines > 0 && strings.Count(string(body), "\n") != tt.lines {
+				t.Errorf("feed has %d lines, want %d:\n%s", strings.Count(string(body), "\n"), tt.lines, body)
+			}
+		})
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/products/feed?format=atom", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("unknown format: status = %d, want 400", resp.StatusCode)
+	}
+}
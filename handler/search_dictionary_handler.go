@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"ecommerce_product_listing/models"
+	"ecommerce_product_listing/repository"
+	"errors"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Admin endpoints for the synonym and stop-word dictionaries applied to fts and
+// search_engine queries. Edits apply to the next search.
+
+func (h *ProductHandler) GetSynonyms(c *fiber.Ctx) error {
+
+	synonyms, err := h.Service.ListSynonyms(c.Context())
+	if err != nil {
+		log.Error("Failed to fetch synonyms:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch synonyms",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"synonyms": synonyms,
+	})
+}
+
+// PutSynonym sets the synonyms of the term in the path, replacing any it had.
+func (h *ProductHandler) PutSynonym(c *fiber.Ctx) error {
+
+	var synonym models.Synonym
+
+	if err := c.BodyParser(&synonym); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	term, err := url.PathUnescape(c.Params("term"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid term",
+		})
+	}
+	synonym.Term = term
+
+	result, err := h.Service.PutSynonym(c.Context(), &synonym)
+	if err != nil {
+		return dictionaryErrorResponse(c, "synonym", err)
+	}
+
+	return c.JSON(result)
+}
+
+func (h *ProductHandler) DeleteSynonym(c *fiber.Ctx) error {
+
+	term, err := url.PathUnescape(c.Params("term"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid term",
+		})
+	}
+
+	if err := h.Service.DeleteSynonym(c.Context(), term); err != nil {
+		return dictionaryErrorResponse(c, "synonym", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *ProductHandler) GetStopWords(c *fiber.Ctx) error {
+
+	stopWords, err := h.Service.ListStopWords(c.Context())
+	if err != nil {
+		log.Error("Failed to fetch stop words:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch stop words",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"stop_words": stopWords,
+	})
+}
+
+func (h *ProductHandler) PutStopWord(c *fiber.Ctx) error {
+
+	word, err := url.PathUnescape(c.Params("word"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid word",
+		})
+	}
+	stopWord := models.StopWord{Word: word}
+
+	result, err := h.Service.AddStopWord(c.Context(), &stopWord)
+	if err != nil {
+		return dictionaryErrorResponse(c, "stop word", err)
+	}
+
+	return c.JSON(result)
+}
+
+func (h *ProductHandler) DeleteStopWord(c *fiber.Ctx) error {
+
+	word, err := url.PathUnescape(c.Params("word"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid word",
+		})
+	}
+
+	if err := h.Service.DeleteStopWord(c.Context(), word); err != nil {
+		return dictionaryErrorResponse(c, "stop word", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// dictionaryErrorResponse maps a dictionary write error to 400, 404 or 500.
+func dictionaryErrorResponse(c *fiber.Ctx, entry string, err error) error {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":         "invalid " + entry,
+			"error_message": validationErr.Error(),
+			"field":         validationErr.Field,
+		})
+	}
+	if errors.Is(err, repository.ErrSynonymNotFound) || errors.Is(err, repository.ErrStopWordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": entry + " not found",
+		})
+	}
+
+	log.Error("Failed to update "+entry+":", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "failed to update " + entry,
+	})
+}
@@ -0,0 +1,335 @@
+package interpret
+
+import (
+	"ecommerce_product_listing/models"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Lexicon recognises the catalog's brands, categories and currencies in queries.
+// Build one per vocabulary and reuse it; it is safe for concurrent use.
+type Lexicon struct {
+	brands     map[string]string // term key -> brand as stored
+	categories map[string]string
+	currencies map[string]bool
+	maxWords   int
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+func NewLexicon(vocabulary *models.Vocabulary) *Lexicon {
+	l := &Lexicon{brands: map[string]string{}, categories: map[string]string{}, currencies: map[string]bool{}}
+
+	add := func(terms map[string]string, value string, key func([]string) string) {
+		words := wordPattern.FindAllString(strings.ToLower(value), -1)
+		// Single letters and filler words would match far too much
+		if len(words) == 0 || (len(words) == 1 && (len(words[0]) < 2 || fillerWords[words[0]])) {
+			return
+		}
+		if _, ok := terms[key(words)]; !ok {
+			terms[key(words)] = value
+		}
+		l.maxWords = max(l.maxWords, len(words))
+	}
+	for _, brand := range vocabulary.Brands {
+		add(l.brands, brand, brandKey)
+	}
+	for _, category := range vocabulary.Categories {
+		add(l.categories, category, categoryKey)
+	}
+	for _, currency := range vocabulary.Currencies {
+		l.currencies[strings.ToUpper(currency)] = true
+	}
+
+	return l
+}
+
+func brandKey(words []string) string {
+	return strings.Join(words, " ")
+}
+
+// categoryKey singularises the last word, so "smartphones" finds "Smartphone" and
+// "laptop" finds "Laptops".
+func categoryKey(words []string) string {
+	last := words[len(words)-1]
+	switch {
+	case len(last) > 4 && strings.HasSuffix(last, "ies"):
+		last = strings.TrimSuffix(last, "ies") + "y"
+	case len(last) > 3 && strings.HasSuffix(last, "s") && !strings.HasSuffix(last, "ss"):
+		last = strings.TrimSuffix(last, "s")
+	}
+	return strings.Join(append(words[:len(words)-1:len(words)-1], last), " ")
+}
+
+// fillerWords are dropped from what is left of a query once something was
+// recognised in it: "show me cheap laptops from Dell" searches for nothing further.
+var fillerWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "for": true, "from": true, "by": true, "in": true,
+	"with": true, "of": true, "show": true, "me": true, "find": true, "i": true, "want": true,
+	"need": true, "buy": true, "some": true, "cheap": true, "best": true, "good": true, "top": true,
+	"rated": true, "price": true, "priced": true, "costing": true, "that": true, "cost": true,
+}
+
+const (
+	money  = `(?:[$€£¥₹]\s*|(?:usd|eur|gbp|inr|jpy)\s*)?\d[\d,]*(?:\.\d+)?k?(?:\s*(?:usd|eur|gbp|inr|jpy|dollars?|bucks|euros?|pounds?|rupees?|yen)\b)?`
+	rating = `([1-5](?:\.\d)?)`
+)
+
+var (
+	priceBetween = regexp.MustCompile(`(?i)\b(?:between|from)\s+(` + money + `)\s*(?:and|to|-)\s*(` + money + `)`)
+	priceMax     = regexp.MustCompile(`(?i)(?:\b(?:under|below|less than|cheaper than|up to|at most|max(?:imum)?|within)|<=?)\s*(` + money + `)`)
+	priceMin     = regexp.MustCompile(`(?i)(?:\b(?:over|above|more than|at least|min(?:imum)?|starting at)|>=?)\s*(` + money + `)`)
+	priceMaxPost = regexp.MustCompile(`(?i)(` + money + `)\s+(?:or less|or under|or below|and under|and below|max)\b`)
+	priceMinPost = regexp.MustCompile(`(?i)(` + money + `)\s+(?:or more|and up|and above|and over|min)\b`)
+
+	ratingStars = regexp.MustCompile(`(?i)(?:\b(?:at least|min(?:imum)?|rated)\s+)?\b` + rating +
+		`\s*\+?\s*-?\s*(?:stars?|★)(?:\s*(?:and|&)\s*(?:up|above|over|higher)|\s*or\s*(?:more|higher|better|above)|\s*\+)?`)
+	ratingRated = regexp.MustCompile(`(?i)\b(?:rated|rating)\s+(?:of\s+)?` + rating +
+		`\s*(?:\+|(?:and|&)\s*(?:up|above|over|higher)|or\s*(?:more|higher|better|above))`)
+
+	currencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY", "₹": "INR"}
+	currencyWords   = map[string]string{
+		"dollar": "USD", "dollars": "USD", "bucks": "USD", "euro": "EUR", "euros": "EUR",
+		"pound": "GBP", "pounds": "GBP", "rupee": "INR", "rupees": "INR", "yen": "JPY",
+	}
+	moneyParts = regexp.MustCompile(`(?i)^([$€£¥₹]|usd|eur|gbp|inr|jpy)?\s*(\d[\d,]*(?:\.\d+)?)(k?)\s*(\pL+)?$`)
+)
+
+// fieldSet says which constraints a parse may extract. Text for the others stays
+// in the search text.
+type fieldSet struct {
+	minPrice, maxPrice, rating, brand, category bool
+}
+
+var allFields = fieldSet{minPrice: true, maxPrice: true, rating: true, brand: true, category: true}
+
+// Parse pulls price, rating, brand and category constraints out of a query. What
+// is left becomes SearchText; a query where nothing was recognised is kept as is.
+func (l *Lexicon) Parse(query string) *models.QueryInterpretation {
+	return l.parse(query, allFields)
+}
+
+func (l *Lexicon) parse(query string, fields fieldSet) *models.QueryInterpretation {
+	in := &models.QueryInterpretation{Query: query}
+	text := query
+
+	// Ratings first, so "4+ stars" isn't read as a price
+	if fields.rating {
+		text = replaceAll(text, ratingStars, func(m []string) {
+			in.MinRating = parseRating(m[1])
+		})
+		text = replaceAll(text, ratingRated, func(m []string) {
+			in.MinRating = parseRating(m[1])
+		})
+	}
+
+	if fields.minPrice && fields.maxPrice {
+		text = replaceAll(text, priceBetween, func(m []string) {
+			low, high := l.parseMoney(m[1], in), l.parseMoney(m[2], in)
+			if low != nil && high != nil && *low > *high {
+				low, high = high, low
+			}
+			in.MinPrice, in.MaxPrice = low, high
+		})
+	}
+	if fields.maxPrice {
+		for _, pattern := range []*regexp.Regexp{priceMax, priceMaxPost} {
+			text = replaceAll(text, pattern, func(m []string) {
+				in.MaxPrice = l.parseMoney(m[1], in)
+			})
+		}
+	}
+	if fields.minPrice {
+		for _, pattern := range []*regexp.Regexp{priceMin, priceMinPost} {
+			text = replaceAll(text, pattern, func(m []string) {
+				in.MinPrice = l.parseMoney(m[1], in)
+			})
+		}
+	}
+
+	text = l.extractTerms(text, in, fields)
+
+	if text == query {
+		in.SearchText = strings.TrimSpace(query)
+		return in
+	}
+
+	words := []string{}
+	for _, word := range strings.Fields(text) {
+		if fillerWords[strings.ToLower(strings.Trim(word, ",.;:!?"))] {
+			continue
+		}
+		// An OR whose other side was extracted has nothing left to join
+		if strings.EqualFold(word, "or") && (len(words) == 0 || strings.EqualFold(words[len(words)-1], "or")) {
+			continue
+		}
+		words = append(words, word)
+	}
+	if len(words) > 0 && strings.EqualFold(words[len(words)-1], "or") {
+		words = words[:len(words)-1]
+	}
+	in.SearchText = strings.Join(words, " ")
+	return in
+}
+
+// Apply interprets the filter's search text and fills in the filter fields the
+// caller left unset from it. Only the text behind those fields is removed from the
+// search; a price, rating, brand or category the caller already filtered on stays
+// in the search text and out of the interpretation.
+func (l *Lexicon) Apply(f *models.ProductFilter) *models.QueryInterpretation {
+	if strings.TrimSpace(f.SearchQueryText) == "" {
+		return nil
+	}
+
+	in := l.parse(f.SearchQueryText, fieldSet{
+		minPrice: f.MinPrice == models.DefaultMinPrice,
+		maxPrice: f.MaxPrice == models.DefaultMaxPrice,
+		rating:   f.RatingMoreThanEqual <= 0,
+		brand:    len(f.Brand) == 0,
+		category: len(f.Category) == 0,
+	})
+
+	if in.MinPrice != nil {
+		f.MinPrice = *in.MinPrice
+	}
+	if in.MaxPrice != nil {
+		f.MaxPrice = *in.MaxPrice
+	}
+	if in.Currency != "" {
+		if len(f.Currency) == 0 {
+			f.Currency = []string{in.Currency}
+		} else {
+			in.Currency = ""
+		}
+	}
+	if in.MinRating != nil {
+		f.RatingMoreThanEqual = *in.MinRating
+	}
+	if len(in.Brands) > 0 {
+		f.Brand = in.Brands
+	}
+	if len(in.Categories) > 0 {
+		f.Category = in.Categories
+	}
+	f.SearchQueryText = in.SearchText
+
+	return in
+}
+
+// extractTerms removes known brands and categories from text, longest match first,
+// along with a leading "from" or "by" for brands and "in" for categories.
+func (l *Lexicon) extractTerms(text string, in *models.QueryInterpretation, fields fieldSet) string {
+	spans := wordPattern.FindAllStringIndex(text, -1)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = strings.ToLower(text[span[0]:span[1]])
+	}
+
+	var out strings.Builder
+	copied := 0
+	for i := 0; i < len(words); {
+		n, brand, category := l.matchAt(words, i, fields)
+		if n == 0 {
+			i++
+			continue
+		}
+
+		start := spans[i][0]
+		if i > 0 && spans[i-1][0] >= copied {
+			previous := words[i-1]
+			if (brand != "" && (previous == "from" || previous == "by")) || (category != "" && previous == "in") {
+				start = spans[i-1][0]
+			}
+		}
+		if brand != "" {
+			in.Brands = appendUnique(in.Brands, brand)
+		} else {
+			in.Categories = appendUnique(in.Categories, category)
+		}
+
+		out.WriteString(text[copied:start])
+		out.WriteString(" ")
+		copied = spans[i+n-1][1]
+		i += n
+	}
+	if copied == 0 {
+		return text
+	}
+	out.WriteString(text[copied:])
+	return out.String()
+}
+
+// matchAt finds the longest brand or category starting at word i. A term that is
+// both counts as a brand after "from" or "by" and as a category otherwise.
+func (l *Lexicon) matchAt(words []string, i int, fields fieldSet) (int, string, string) {
+	for n := min(l.maxWords, len(words)-i); n > 0; n-- {
+		candidate := words[i : i+n]
+		brand, isBrand := l.brands[brandKey(candidate)]
+		category, isCategory := l.categories[categoryKey(candidate)]
+		isBrand, isCategory = isBrand && fields.brand, isCategory && fields.category
+		afterBrandWord := i > 0 && (words[i-1] == "from" || words[i-1] == "by")
+		switch {
+		case isBrand && (!isCategory || afterBrandWord):
+			return n, brand, ""
+		case isCategory:
+			return n, "", category
+		}
+	}
+	return 0, "", ""
+}
+
+// parseMoney reads an amount such as "€1,299", "500 dollars" or "2k", recording its
+// currency when the catalog has products priced in it.
+func (l *Lexicon) parseMoney(s string, in *models.QueryInterpretation) *float64 {
+	m := moneyParts.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(m[2], ",", ""), 64)
+	if err != nil {
+		return nil
+	}
+	if m[3] != "" {
+		amount *= 1000
+	}
+
+	currency := strings.ToUpper(m[1])
+	if symbol, ok := currencySymbols[m[1]]; ok {
+		currency = symbol
+	}
+	if word, ok := currencyWords[strings.ToLower(m[4])]; ok {
+		currency = word
+	} else if m[4] != "" {
+		currency = strings.ToUpper(m[4])
+	}
+	if l.currencies[currency] {
+		in.Currency = currency
+	}
+
+	return &amount
+}
+
+func parseRating(s string) *float64 {
+	rating, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &rating
+}
+
+// replaceAll blanks out every match of pattern in text, calling fn with its submatches.
+func replaceAll(text string, pattern *regexp.Regexp, fn func(m []string)) string {
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		fn(pattern.FindStringSubmatch(match))
+		return " "
+	})
+}
+
+func appendUnique(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
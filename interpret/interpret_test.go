@@ -0,0 +1,108 @@
+package interpret
+
+import (
+	"ecommerce_product_listing/models"
+	"slices"
+	"testing"
+)
+
+func testLexicon() *Lexicon {
+	return NewLexicon(&models.Vocabulary{
+		Brands:     []string{"Apple", "Samsung", "Sony"},
+		Categories: []string{"Laptops", "Headphones", "Smartphones"},
+		Currencies: []string{"USD", "EUR"},
+	})
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query      string
+		searchText string
+		brands     []string
+		categories []string
+		minPrice   float64
+		maxPrice   float64
+		currency   string
+		minRating  float64
+	}{
+		{query: "wireless noise cancelling", searchText: "wireless noise cancelling"},
+		{query: "show me cheap laptops from Apple under $1,500", categories: []string{"Laptops"}, brands: []string{"Apple"}, maxPrice: 1500, currency: "USD"},
+		{query: "sony headphones between 100 and 300 euros 4+ stars", brands: []string{"Sony"}, categories: []string{"Headphones"}, minPrice: 100, maxPrice: 300, currency: "EUR", minRating: 4},
+		{query: "samsung or apple smartphone", brands: []string{"Samsung", "Apple"}, categories: []string{"Smartphones"}},
+		{query: "gaming laptop over 2k rated 4.5 and up", searchText: "gaming", categories: []string{"Laptops"}, minPrice: 2000, minRating: 4.5},
+	}
+
+	l := testLexicon()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			in := l.Parse(tt.query)
+
+			if in.SearchText != tt.searchText {
+				t.Errorf("search text = %q, want %q", in.SearchText, tt.searchText)
+			}
+			if !slices.Equal(in.Brands, tt.brands) || !slices.Equal(in.Categories, tt.categories) {
+				t.Errorf("brands %v categories %v, want %v %v", in.Brands, in.Categories, tt.brands, tt.categories)
+			}
+			for _, bound := range []struct {
+				name string
+				got  *float64
+				want float64
+			}{
+				{"min price", in.MinPrice, tt.minPrice},
+				{"max price", in.MaxPrice, tt.maxPrice},
+				{"min rating", in.MinRating, tt.minRating},
+			} {
+				if (bound.got == nil) != (bound.want == 0) || (bound.got != nil && *bound.got != bound.want) {
+					t.Errorf("%s = %v, want %v", bound.name, bound.got, bound.want)
+				}
+			}
+			if in.Currency != tt.currency {
+				t.Errorf("currency = %q, want %q", in.Currency, tt.currency)
+			}
+		})
+	}
+}
+
+// TestApplyKeepsCallerFilters checks that text behind a filter the caller set is
+// neither applied nor removed from the search.
+func TestApplyKeepsCallerFilters(t *testing.T) {
+	l := testLexicon()
+
+	f := models.NewProductFilter()
+	f.SearchQueryText = "sony headphones under $200 4+ stars"
+	f.Brand = []string{"Bose"}
+	f.MaxPrice = 150
+	in := l.Apply(f)
+
+	if f.SearchQueryText != "sony under $200" {
+		t.Errorf("search text = %q, want %q", f.SearchQueryText, "sony under $200")
+	}
+	if in.SearchText != f.SearchQueryText {
+		t.Errorf("interpretation search text = %q, want %q", in.SearchText, f.SearchQueryText)
+	}
+	if len(in.Brands) != 0 || in.MaxPrice != nil || in.Currency != "" {
+		t.Errorf("interpretation reports skipped fields: %+v", in)
+	}
+	if !slices.Equal(f.Brand, []string{"Bose"}) || f.MaxPrice != 150 {
+		t.Errorf("caller filters changed: brand %v max price %v", f.Brand, f.MaxPrice)
+	}
+	if !slices.Equal(f.Category, []string{"Headphones"}) || f.RatingMoreThanEqual != 4 {
+		t.Errorf("category %v rating %v, want [Headphones] 4", f.Category, f.RatingMoreThanEqual)
+	}
+}
+
+func TestApplyCurrencyFromCaller(t *testing.T) {
+	l := testLexicon()
+
+	f := models.NewProductFilter()
+	f.SearchQueryText = "laptops under 900 euros"
+	f.Currency = []string{"USD"}
+	in := l.Apply(f)
+
+	if f.MaxPrice != 900 || f.SearchQueryText != "" {
+		t.Errorf("max price %v search text %q, want 900 and none", f.MaxPrice, f.SearchQueryText)
+	}
+	if !slices.Equal(f.Currency, []string{"USD"}) || in.Currency != "" {
+		t.Errorf("currency %v, interpretation %q; want the caller's USD kept", f.Currency, in.Currency)
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"ecommerce_product_listing/codec"
 	"ecommerce_product_listing/config"
 	"ecommerce_product_listing/handler"
 	"ecommerce_product_listing/repository"
 	"ecommerce_product_listing/service"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -13,14 +19,23 @@ import (
 
 func main() {
 	config.LoadEnv()
-	config.ConnectDB()
-	config.Initialize()
 
-	repo := &repository.ProductRepository{}
+	var repo repository.ProductStore
+	if config.StoreBackend() == config.MemoryStore {
+		repo = newMemoryStore(config.StoreSeedFile())
+	} else {
+		config.ConnectDB()
+		config.Initialize()
+		repo = &repository.ProductRepository{}
+	}
+
 	service := &service.ProductService{Repo: repo}
 	handler := &handler.ProductHandler{Service: service}
 
 	app := fiber.New(fiber.Config{
+		// Lets /products/import read large bodies as a stream instead of buffering them.
+		// Every other route goes through handler.LimitBody.
+		StreamRequestBody: true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			// Default 500
 			code := fiber.StatusInternalServerError
@@ -44,6 +59,11 @@ func main() {
 		Format: "[${time}] ${status} - ${method} ${path} - ${error}\n",
 	}))
 
+	// Registered ahead of LimitBody, which it never reaches, so the body is streamed
+	app.Post("/api/v1/products/import", handler.ImportProducts)
+
+	app.Use(handler.LimitBody(fiber.DefaultBodyLimit))
+
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
 
@@ -51,8 +71,29 @@ func main() {
 
 	products.Get("/", handler.GetProducts)
 	products.Get("/counts", handler.GetCounts)
+	products.Get("/facets", handler.GetFacets)
+	products.Get("/suggest", handler.GetSuggestions)
+	products.Get("/export", handler.ExportProducts)
+	products.Get("/feed", handler.GetFeed)
 	products.Post("/", handler.AddProduct)
 	products.Post("/bulk", handler.AddProductsBulk)
+	products.Post("/search", handler.SearchProducts)
+	products.Get("/asin/:asin", handler.GetProductByASIN)
+	products.Get("/:id<int>", handler.GetProduct)
+	products.Put("/:id<int>", handler.UpdateProduct)
+	products.Patch("/:id<int>", handler.PatchProduct)
+	products.Delete("/:id<int>", handler.DeleteProduct)
+	products.Post("/:id<int>/restore", handler.RestoreProduct)
+	products.Delete("/:id<int>/purge", handler.AdminOnly, handler.PurgeProduct)
+
+	admin := v1.Group("/admin", handler.AdminOnly)
+
+	admin.Get("/synonyms", handler.GetSynonyms)
+	admin.Put("/synonyms/:term", handler.PutSynonym)
+	admin.Delete("/synonyms/:term", handler.DeleteSynonym)
+	admin.Get("/stop-words", handler.GetStopWords)
+	admin.Put("/stop-words/:word", handler.PutStopWord)
+	admin.Delete("/stop-words/:word", handler.DeleteStopWord)
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -68,3 +109,37 @@ func main() {
 
 	app.Listen(":8080")
 }
+
+// newMemoryStore builds the in-memory store, importing seedFile when one is given.
+// The format follows the file extension.
+func newMemoryStore(seedFile string) *repository.MemoryProductRepository {
+	store := repository.NewMemoryProductRepository()
+	log.Println("Using in-memory product store")
+	if seedFile == "" {
+		return store
+	}
+
+	format, err := codec.ParseFormat(strings.TrimPrefix(filepath.Ext(seedFile), "."))
+	if err != nil {
+		log.Fatal("Unable to seed memory store:", err)
+	}
+
+	file, err := os.Open(seedFile)
+	if err != nil {
+		log.Fatal("Unable to seed memory store:", err)
+	}
+	defer file.Close()
+
+	src, err := codec.NewProductSource(format, file)
+	if err != nil {
+		log.Fatal("Unable to seed memory store:", err)
+	}
+
+	result, err := store.ImportProducts(context.Background(), src, nil)
+	if err != nil {
+		log.Fatal("Unable to seed memory store:", err)
+	}
+	log.Printf("Seeded memory store from %s: %d products, %d invalid rows", seedFile, result.Inserted, result.Invalid)
+
+	return store
+}
@@ -0,0 +1,56 @@
+package models
+
+import "strconv"
+
+type CountModeEnum string
+
+const (
+	ExactCountMode    CountModeEnum = "exact"    // COUNT(*) over every match
+	EstimateCountMode CountModeEnum = "estimate" // planner row estimate, no rows read
+	CappedCountMode   CountModeEnum = "capped"   // exact up to CountCap, then "<cap>+"
+)
+
+func (m CountModeEnum) IsValid() bool {
+	return m == ExactCountMode || m == EstimateCountMode || m == CappedCountMode
+}
+
+const (
+	DefaultCountCap = 10000
+	MaxCountCap     = 1000000
+)
+
+// Count is a result-set size as produced by one of the count modes.
+type Count struct {
+	Count   int64         `json:"count"`
+	Mode    CountModeEnum `json:"count_mode"`
+	Capped  bool          `json:"capped,omitempty"` // more than Count rows match
+	Display string        `json:"display"`          // e.g. "1,234", "~1,200" or "10,000+"
+}
+
+// NewCount builds a Count with its display string.
+func NewCount(n int64, mode CountModeEnum, capped bool) *Count {
+	display := formatThousands(n)
+	switch {
+	case capped:
+		display += "+"
+	case mode == EstimateCountMode:
+		display = "~" + display
+	}
+	return &Count{Count: n, Mode: mode, Capped: capped, Display: display}
+}
+
+func formatThousands(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	if n < 0 {
+		return "-" + formatThousands(-n)
+	}
+
+	out := make([]byte, 0, len(digits)+len(digits)/3)
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
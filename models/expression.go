@@ -0,0 +1,290 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// FilterExpression is one node of a boolean filter tree, as sent to POST
+// /products/search. Exactly one field is set:
+//
+//	{"and": [
+//	  {"or": [{"eq": {"field": "brand", "value": "Apple"}}, {"eq": {"field": "brand", "value": "Samsung"}}]},
+//	  {"range": {"field": "price", "lt": 500}},
+//	  {"not": {"eq": {"field": "category", "value": "Refurbished"}}}
+//	]}
+//
+// A comparison against a missing (NULL) value is false, and "not" of it is true.
+type FilterExpression struct {
+	And    []FilterExpression `json:"and,omitempty"`
+	Or     []FilterExpression `json:"or,omitempty"`
+	Not    *FilterExpression  `json:"not,omitempty"`
+	Eq     *FieldValue        `json:"eq,omitempty"`
+	In     *FieldValues       `json:"in,omitempty"`
+	Range  *FieldRange        `json:"range,omitempty"`
+	Exists *FieldRef          `json:"exists,omitempty"`
+	Match  *TextMatch         `json:"match,omitempty"`
+}
+
+type FieldRef struct {
+	Field string `json:"field"`
+}
+
+type FieldValue struct {
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+type FieldValues struct {
+	Field  string        `json:"field"`
+	Values []interface{} `json:"values"`
+}
+
+// FieldRange bounds a number or time field; at least one bound is required.
+type FieldRange struct {
+	Field string      `json:"field"`
+	GT    interface{} `json:"gt,omitempty"`
+	GTE   interface{} `json:"gte,omitempty"`
+	LT    interface{} `json:"lt,omitempty"`
+	LTE   interface{} `json:"lte,omitempty"`
+}
+
+// TextMatch is a full-text search over title and description, or a case-insensitive
+// substring match on one text field when Field is set.
+type TextMatch struct {
+	Query string `json:"query"`
+	Field string `json:"field,omitempty"`
+}
+
+type FieldType string
+
+const (
+	TextField    FieldType = "text"
+	NumberField  FieldType = "number"
+	IntegerField FieldType = "integer"
+	BoolField    FieldType = "bool"
+	TimeField    FieldType = "time"
+)
+
+// FilterFields whitelists the columns a filter expression may reference.
+var FilterFields = map[string]FieldType{
+	"id":                   IntegerField,
+	"title":                TextField,
+	"asin":                 TextField,
+	"description":          TextField,
+	"category":             TextField,
+	"brand":                TextField,
+	"currency":             TextField,
+	"country":              TextField,
+	"price":                NumberField,
+	"avg_rating":           NumberField,
+	"stock":                IntegerField,
+	"review_count":         IntegerField,
+	"bought_in_last_month": IntegerField,
+	"is_best_seller":       BoolField,
+	"created_at":           TimeField,
+	"updated_at":           TimeField,
+}
+
+const (
+	MaxExpressionDepth = 8
+	MaxExpressionNodes = 100
+	MaxInValues        = 500
+)
+
+// Validate checks the tree against FilterFields and the size limits, and converts
+// every value to its field's Go type: string, float64, int64, bool or time.Time.
+func (e *FilterExpression) Validate() error {
+	nodes := 0
+	return e.validate("filter", 1, &nodes)
+}
+
+func (e *FilterExpression) validate(path string, depth int, nodes *int) error {
+	*nodes++
+	if depth > MaxExpressionDepth {
+		return &ValidationError{Field: path, Message: fmt.Sprintf("nests deeper than %d levels", MaxExpressionDepth)}
+	}
+	if *nodes > MaxExpressionNodes {
+		return &ValidationError{Field: path, Message: fmt.Sprintf("filter has more than %d nodes", MaxExpressionNodes)}
+	}
+
+	set := 0
+	for _, isSet := range []bool{
+		e.And != nil, e.Or != nil, e.Not != nil, e.Eq != nil, e.In != nil, e.Range != nil, e.Exists != nil, e.Match != nil,
+	} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return &ValidationError{Field: path, Message: "must have exactly one of and, or, not, eq, in, range, exists, match"}
+	}
+
+	switch {
+	case e.And != nil || e.Or != nil:
+		op, children := "and", e.And
+		if e.Or != nil {
+			op, children = "or", e.Or
+		}
+		if len(children) == 0 {
+			return &ValidationError{Field: path + "." + op, Message: "must not be empty"}
+		}
+		for i := range children {
+			if err := children[i].validate(fmt.Sprintf("%s.%s[%d]", path, op, i), depth+1, nodes); err != nil {
+				return err
+			}
+		}
+
+	case e.Not != nil:
+		return e.Not.validate(path+".not", depth+1, nodes)
+
+	case e.Eq != nil:
+		path += ".eq"
+		fieldType, err := filterField(path, e.Eq.Field)
+		if err != nil {
+			return err
+		}
+		e.Eq.Value, err = coerceFilterValue(path+".value", fieldType, e.Eq.Value)
+		return err
+
+	case e.In != nil:
+		path += ".in"
+		fieldType, err := filterField(path, e.In.Field)
+		if err != nil {
+			return err
+		}
+		if len(e.In.Values) == 0 || len(e.In.Values) > MaxInValues {
+			return &ValidationError{Field: path + ".values", Message: fmt.Sprintf("must have 1 to %d values", MaxInValues)}
+		}
+		for i := range e.In.Values {
+			if e.In.Values[i], err = coerceFilterValue(fmt.Sprintf("%s.values[%d]", path, i), fieldType, e.In.Values[i]); err != nil {
+				return err
+			}
+		}
+
+	case e.Range != nil:
+		path += ".range"
+		fieldType, err := filterField(path, e.Range.Field)
+		if err != nil {
+			return err
+		}
+		if fieldType != NumberField && fieldType != IntegerField && fieldType != TimeField {
+			return &ValidationError{Field: path + ".field", Message: "is not a number or time field"}
+		}
+		bounds := 0
+		for name, bound := range map[string]*interface{}{"gt": &e.Range.GT, "gte": &e.Range.GTE, "lt": &e.Range.LT, "lte": &e.Range.LTE} {
+			if *bound == nil {
+				continue
+			}
+			bounds++
+			if *bound, err = coerceFilterValue(path+"."+name, fieldType, *bound); err != nil {
+				return err
+			}
+		}
+		if bounds == 0 {
+			return &ValidationError{Field: path, Message: "needs at least one of gt, gte, lt, lte"}
+		}
+
+	case e.Exists != nil:
+		_, err := filterField(path+".exists", e.Exists.Field)
+		return err
+
+	case e.Match != nil:
+		path += ".match"
+		if strings.TrimSpace(e.Match.Query) == "" {
+			return &ValidationError{Field: path + ".query", Message: "is required"}
+		}
+		if e.Match.Field != "" {
+			fieldType, err := filterField(path, e.Match.Field)
+			if err != nil {
+				return err
+			}
+			if fieldType != TextField {
+				return &ValidationError{Field: path + ".field", Message: "is not a text field"}
+			}
+		}
+	}
+
+	return nil
+}
+
+func filterField(path, field string) (FieldType, error) {
+	fieldType, ok := FilterFields[field]
+	if !ok {
+		return "", &ValidationError{Field: path + ".field", Message: fmt.Sprintf("unknown field %q", field)}
+	}
+	return fieldType, nil
+}
+
+// coerceFilterValue converts a decoded JSON value to the Go type of fieldType.
+func coerceFilterValue(path string, fieldType FieldType, value interface{}) (interface{}, error) {
+	invalid := &ValidationError{Field: path, Message: "must be of type " + string(fieldType)}
+
+	switch fieldType {
+	case TextField:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case NumberField:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+	case IntegerField:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), nil
+			}
+		case int64:
+			return v, nil
+		}
+	case BoolField:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case TimeField:
+		switch v := value.(type) {
+		case string:
+			if t, err := ParseFilterTime(v); err == nil {
+				return t, nil
+			}
+		case time.Time:
+			return v, nil
+		}
+		invalid.Message = "must be an RFC3339 timestamp or YYYY-MM-DD date"
+	}
+
+	return nil, invalid
+}
+
+// SearchRequest is the body of POST /products/search.
+type SearchRequest struct {
+	Filter         *FilterExpression `json:"filter"`
+	SortByColumn   SortByEnum        `json:"sort_by_column"`
+	SortOrder      SortOrderEnum     `json:"sort_order"`
+	Cursor         string            `json:"cursor"`
+	PageSize       int               `json:"page_size"`
+	ShowOutOfStock bool              `json:"show_out_of_stock"`
+	IncludeFacets  bool              `json:"include_facets"`
+}
+
+// ProductFilter turns the request into a listing filter with the usual defaults.
+func (r *SearchRequest) ProductFilter() *ProductFilter {
+	f := NewProductFilter()
+	f.Expression = r.Filter
+	f.Cursor = r.Cursor
+	f.ShowOutOfStock = r.ShowOutOfStock
+	f.IncludeFacets = r.IncludeFacets
+	if r.SortByColumn != "" {
+		f.SortByColumn = r.SortByColumn
+	}
+	if r.SortOrder != "" {
+		f.SortOrder = r.SortOrder
+	}
+	if r.PageSize != 0 {
+		f.PageSize = r.PageSize
+	}
+	return f
+}
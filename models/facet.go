@@ -0,0 +1,43 @@
+package models
+
+// FacetCount is the number of products matching the current filter for one facet value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facets drive the listing sidebar. Each facet is counted without its own filter
+// applied, so selected values keep showing their siblings.
+type Facets struct {
+	Categories []FacetCount `json:"categories"`
+	Brands     []FacetCount `json:"brands"`
+	Ratings    []FacetCount `json:"ratings"`     // value "4" counts products rated 4 and up
+	BestSeller []FacetCount `json:"best_seller"` // "true" / "false"
+	Stock      []FacetCount `json:"stock"`       // "in_stock" / "out_of_stock"
+
+	// One histogram per currency; prices in different currencies are never bucketed together
+	Prices []PriceHistogram `json:"prices"`
+}
+
+type PriceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+// PriceHistogram splits [Min, Max] into equal-width buckets for a price slider.
+type PriceHistogram struct {
+	Currency string        `json:"currency"`
+	Min      float64       `json:"min"`
+	Max      float64       `json:"max"`
+	Buckets  []PriceBucket `json:"buckets"`
+}
+
+const (
+	MaxFacetValues      = 50
+	DefaultPriceBuckets = 10
+	MaxPriceBuckets     = 50
+)
+
+// RatingFacetThresholds are the "N stars & up" buckets, highest first.
+var RatingFacetThresholds = []int{4, 3, 2, 1}
@@ -0,0 +1,52 @@
+package models
+
+import "fmt"
+
+// ProductSource streams products for bulk import. Next returns the product and the
+// input line it came from, or io.EOF once the input is exhausted. A *RowDecodeError
+// rejects only that line; any other error ends the input.
+type ProductSource interface {
+	Next() (*Product, int, error)
+}
+
+// RowDecodeError is a line a ProductSource could not decode into a product. Field
+// names the offending column when it is known.
+type RowDecodeError struct {
+	Line  int
+	Field string
+	Err   error
+}
+
+func (e *RowDecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("line %d: %s: %v", e.Line, e.Field, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowDecodeError) Unwrap() error {
+	return e.Err
+}
+
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportResult summarises a COPY-based import. Unchanged covers rows that matched
+// an existing ASIN without changing it, later duplicates of an ASIN within the
+// same import, and conflicts skipped with on_conflict=skip.
+type ImportResult struct {
+	Received      int64            `json:"received"`
+	Invalid       int64            `json:"invalid"`
+	Inserted      int64            `json:"inserted"`
+	Updated       int64            `json:"updated"`
+	Unchanged     int64            `json:"unchanged"`
+	DurationMS    int64            `json:"duration_ms"`
+	RowsPerSecond float64          `json:"rows_per_second"`
+	Errors        []ImportRowError `json:"errors,omitempty"`
+}
+
+// MaxImportErrors caps how many invalid rows an ImportResult lists.
+const MaxImportErrors = 100
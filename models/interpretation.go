@@ -0,0 +1,22 @@
+package models
+
+// Vocabulary is the set of brands, categories and currencies in the catalog, used
+// to recognise them inside free-text queries.
+type Vocabulary struct {
+	Brands     []string
+	Categories []string
+	Currencies []string
+}
+
+// QueryInterpretation records what was pulled out of a free-text search query and
+// the text left over to search for.
+type QueryInterpretation struct {
+	Query      string   `json:"query"`
+	SearchText string   `json:"search_text"`
+	Brands     []string `json:"brands,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	MinPrice   *float64 `json:"min_price,omitempty"`
+	MaxPrice   *float64 `json:"max_price,omitempty"`
+	Currency   string   `json:"currency,omitempty"`
+	MinRating  *float64 `json:"min_rating,omitempty"`
+}
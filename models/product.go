@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Product struct {
 	ID                int        `json:"id,omitempty"`
@@ -15,15 +20,54 @@ type Product struct {
 	Currency          string     `json:"currency"`
 	Country           string     `json:"country,omitempty"`
 	Stock             int        `json:"stock"`
-	AvgRating         float64    `json:"avg_rating,omitempty"`
-	ReviewCount       int        `json:"review_count,omitempty"`
-	BoughtInLastMonth int        `json:"bought_in_last_month,omitempty"`
+	AvgRating         *float64   `json:"avg_rating,omitempty"`
+	ReviewCount       *int       `json:"review_count,omitempty"`
+	BoughtInLastMonth *int       `json:"bought_in_last_month,omitempty"`
 	IsBestSeller      bool       `json:"is_best_seller,omitempty"`
 	CreatedAt         *time.Time `json:"created_at,omitempty"`
 	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+
+	// Populated only for search_engine searches. The highlights are HTML: the source
+	// text is escaped and matches are wrapped in <mark>.
+	Rank                 *float64 `json:"rank,omitempty"`
+	TitleHighlight       string   `json:"title_highlight,omitempty"`
+	DescriptionHighlight string   `json:"description_highlight,omitempty"`
+
+	// Populated only when sorting by relevance
+	Relevance *float64 `json:"relevance,omitempty"`
+
+	// Populated only for fuzzy searches
+	Similarity *float64 `json:"similarity,omitempty"`
+}
+
+// SortValue formats the product's value for a sort column as a keyset cursor
+// value, or returns nil when the column is NULL for this product.
+func (p *Product) SortValue(column SortByEnum) *string {
+	var value string
+	switch {
+	case column == SortByPrice:
+		value = strconv.FormatFloat(p.Price, 'f', -1, 64)
+	case column == SortByPopularity && p.BoughtInLastMonth != nil:
+		value = strconv.Itoa(*p.BoughtInLastMonth)
+	case column == SortByRating && p.AvgRating != nil:
+		value = strconv.FormatFloat(*p.AvgRating, 'f', -1, 64)
+	case column == SortByModificationDate && p.UpdatedAt != nil:
+		value = p.UpdatedAt.Format(time.RFC3339Nano)
+	// Scores keep every bit of the float8 so the keyset comparison is exact
+	case column == SortByRank && p.Rank != nil:
+		value = strconv.FormatFloat(*p.Rank, 'g', -1, 64)
+	case column == SortByRelevance && p.Relevance != nil:
+		value = strconv.FormatFloat(*p.Relevance, 'g', -1, 64)
+	case column == SortBySimilarity && p.Similarity != nil:
+		value = strconv.FormatFloat(*p.Similarity, 'g', -1, 64)
+	default:
+		return nil
+	}
+	return &value
 }
 
 type SortByEnum string
+
 type SortOrderEnum string
 
 const (
@@ -31,6 +75,12 @@ const (
 	SortByPopularity       SortByEnum = "bought_in_last_month"
 	SortByRating           SortByEnum = "avg_rating"
 	SortByModificationDate SortByEnum = "updated_at"
+	SortByRelevance        SortByEnum = "relevance" // text rank over search_vector; fts and search_engine only
+
+	// SortByRank and SortBySimilarity are not selectable by clients; Normalize sets them
+	// for search_engine and fuzzy searches respectively.
+	SortByRank       SortByEnum = "rank"
+	SortBySimilarity SortByEnum = "similarity"
 )
 
 const (
@@ -40,7 +90,17 @@ const (
 
 func (s SortByEnum) IsValid() bool {
 	switch s {
-	case SortByPrice, SortByPopularity, SortByRating, SortByModificationDate:
+	case SortByPrice, SortByPopularity, SortByRating, SortByModificationDate, SortByRelevance:
+		return true
+	}
+	return false
+}
+
+// Nullable reports whether the column can be NULL, so keyset pages must place
+// NULL rows explicitly (they sort last in either direction).
+func (s SortByEnum) Nullable() bool {
+	switch s {
+	case SortByPopularity, SortByRating, SortByModificationDate:
 		return true
 	}
 	return false
@@ -55,18 +115,21 @@ type SearchTypeEnum string
 const (
 	SimpleTextSearchType   SearchTypeEnum = "simple"        // ilike
 	VectorSearchType       SearchTypeEnum = "fts"           // full-text search using search_vector and websearch_to_tsquery
-	SearchEngineSearchType SearchTypeEnum = "search_engine" // PG_TextSearch with ranking and highlighting (not implemented yet)
+	SearchEngineSearchType SearchTypeEnum = "search_engine" // full-text search ranked by ts_rank_cd with ts_headline highlighting
+	FuzzySearchType        SearchTypeEnum = "fuzzy"         // typo-tolerant pg_trgm word similarity over title and description
 )
 
 func (s SearchTypeEnum) IsValidSearchType() bool {
-	return s == SimpleTextSearchType || s == VectorSearchType || s == SearchEngineSearchType
+	return s == SimpleTextSearchType || s == VectorSearchType || s == SearchEngineSearchType || s == FuzzySearchType
 }
 
 type ProductFilter struct {
 	SearchQueryText     string         `query:"search_query_text,omitempty"`
 	SearchType          SearchTypeEnum `query:"search_type,omitempty"` // true for vector search, false for ILIKE search
-	Category            string         `query:"category,omitempty"`
-	Brand               string         `query:"brand,omitempty"`
+	Category            []string       `query:"category,omitempty"`    // repeated or comma separated
+	Brand               []string       `query:"brand,omitempty"`
+	CategoryNot         []string       `query:"category_not,omitempty"`
+	BrandNot            []string       `query:"brand_not,omitempty"`
 	MinPrice            float64        `query:"min_price,omitempty"`
 	MaxPrice            float64        `query:"max_price,omitempty"`
 	ShowOutOfStock      bool           `query:"show_out_of_stock,omitempty"`
@@ -74,13 +137,54 @@ type ProductFilter struct {
 	ReviewCount         int            `query:"review_count,omitempty"`
 	SortByColumn        SortByEnum     `query:"sort_by_column,omitempty"`
 	SortOrder           SortOrderEnum  `query:"sort_order,omitempty"`
-	SortLastValue       string         `query:"sort_last_value,omitempty"`
-	LastID              int            `query:"last_id,omitempty"`
+	SortLastValue       *string        `query:"-"` // keyset position, set from Cursor; nil is NULL
+	LastID              int            `query:"-"`
 	PageSize            int            `query:"page_size,omitempty"`
 	PageNumber          int            `query:"page_number,omitempty"`
+
+	// Blend weights for the relevance sort; 0 ranks on text match alone
+	RelevancePopularityWeight float64 `query:"relevance_popularity_weight,omitempty"`
+	RelevanceRatingWeight     float64 `query:"relevance_rating_weight,omitempty"`
+
+	// Minimum word similarity (0-1] for fuzzy searches
+	FuzzyThreshold float64 `query:"fuzzy_threshold,omitempty"`
+
+	IsBestSeller  *bool    `query:"is_best_seller,omitempty"`
+	Country       []string `query:"country,omitempty"`
+	Currency      []string `query:"currency,omitempty"`
+	CreatedAfter  string   `query:"created_after,omitempty"` // RFC3339 or YYYY-MM-DD, inclusive
+	CreatedBefore string   `query:"created_before,omitempty"`
+	UpdatedSince  string   `query:"updated_since,omitempty"`
+	UpdatedBefore string   `query:"updated_before,omitempty"`
+
+	// Opaque next_cursor or prev_cursor token from the previous response
+	Cursor string `query:"cursor,omitempty"`
+	// Set from a prev_cursor: fetch the page before the keyset position
+	Backward bool `query:"-"`
+
+	// Return sidebar facet counts alongside the listing
+	IncludeFacets bool `query:"include_facets,omitempty"`
+	PriceBuckets  int  `query:"price_buckets,omitempty"`
+
+	// How /counts sizes the result set; CountCap bounds the capped mode
+	CountMode CountModeEnum `query:"count_mode,omitempty"`
+	CountCap  int           `query:"count_cap,omitempty"`
+
+	// Pull prices, ratings, brands and categories out of SearchQueryText; off by default
+	Interpret bool `query:"interpret"`
+
+	// Boolean filter tree from POST /products/search, ANDed with the fields above
+	Expression *FilterExpression `query:"-"`
 }
 
 func (f *ProductFilter) Normalize() {
+	f.Category = splitValues(f.Category)
+	f.Brand = splitValues(f.Brand)
+	f.CategoryNot = splitValues(f.CategoryNot)
+	f.BrandNot = splitValues(f.BrandNot)
+	f.Country = splitValues(f.Country)
+	f.Currency = splitValues(f.Currency)
+
 	if f.PageSize <= 0 || f.PageSize > 100 {
 		f.PageSize = 20
 	}
@@ -98,6 +202,85 @@ func (f *ProductFilter) Normalize() {
 	if !f.SearchType.IsValidSearchType() {
 		f.SearchType = SimpleTextSearchType
 	}
+
+	// relevance needs a search_vector match to rank against
+	if f.SortByColumn == SortByRelevance &&
+		(f.SearchQueryText == "" || (f.SearchType != VectorSearchType && f.SearchType != SearchEngineSearchType)) {
+		f.SortByColumn = SortByPopularity
+	}
+	if f.RelevancePopularityWeight < 0 {
+		f.RelevancePopularityWeight = 0
+	}
+	if f.RelevanceRatingWeight < 0 {
+		f.RelevanceRatingWeight = 0
+	}
+	if f.FuzzyThreshold <= 0 || f.FuzzyThreshold > 1 {
+		f.FuzzyThreshold = DefaultFuzzyThreshold
+	}
+	if f.PriceBuckets <= 0 || f.PriceBuckets > MaxPriceBuckets {
+		f.PriceBuckets = DefaultPriceBuckets
+	}
+	if !f.CountMode.IsValid() {
+		f.CountMode = ExactCountMode
+	}
+	if f.CountCap <= 0 || f.CountCap > MaxCountCap {
+		f.CountCap = DefaultCountCap
+	}
+
+	// search_engine results are ordered by rank, best match first, unless a blended relevance sort was asked for
+	if f.SearchType == SearchEngineSearchType && f.SearchQueryText != "" && f.SortByColumn != SortByRelevance {
+		f.SortByColumn = SortByRank
+		f.SortOrder = SortOrderDesc
+	}
+
+	// fuzzy results are ordered by similarity, closest match first
+	if f.SearchType == FuzzySearchType && f.SearchQueryText != "" {
+		f.SortByColumn = SortBySimilarity
+		f.SortOrder = SortOrderDesc
+	}
+}
+
+// Validate rejects filter values that can't be compiled into a query.
+func (f *ProductFilter) Validate() error {
+	for name, value := range map[string]string{
+		"created_after":  f.CreatedAfter,
+		"created_before": f.CreatedBefore,
+		"updated_since":  f.UpdatedSince,
+		"updated_before": f.UpdatedBefore,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := ParseFilterTime(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	if f.Expression != nil {
+		return f.Expression.Validate()
+	}
+	return nil
+}
+
+// ParseFilterTime accepts a full RFC3339 timestamp or a plain date (midnight UTC).
+func ParseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// splitValues flattens comma separated query values and drops blanks, so
+// ?brand=Apple&brand=Samsung and ?brand=Apple,Samsung parse the same.
+func splitValues(values []string) []string {
+	out := []string{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
 }
 
 const (
@@ -113,6 +296,8 @@ const (
 	DefaultRatingMoreThanEqual = -1
 	DefaultPageNumber          = -1
 	DefaultSearchType          = SimpleTextSearchType
+	DefaultFuzzyThreshold      = 0.4
+	DefaultInterpret           = false
 )
 
 func NewProductFilter() *ProductFilter {
@@ -128,5 +313,7 @@ func NewProductFilter() *ProductFilter {
 		ShowOutOfStock:      DefaultShowOutOfStock,
 		RatingMoreThanEqual: DefaultRatingMoreThanEqual,
 		SearchType:          DefaultSearchType,
+		FuzzyThreshold:      DefaultFuzzyThreshold,
+		Interpret:           DefaultInterpret,
 	}
 }
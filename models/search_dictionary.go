@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Synonym expands a search term: fts and search_engine queries for Term also match
+// any of Synonyms. The expansion is one way; "tv" -> "television" doesn't make
+// "television" match "tv".
+type Synonym struct {
+	Term      string     `json:"term"`
+	Synonyms  []string   `json:"synonyms"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// StopWord is a word dropped from fts and search_engine queries, on top of the
+// english configuration's own stop list.
+type StopWord struct {
+	Word      string     `json:"word"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+const (
+	MaxSynonyms         = 50
+	MaxSearchTermLength = 100
+)
+
+var stopWordPattern = regexp.MustCompile(`^[\p{L}\p{N}]+$`)
+
+// NormalizeSearchTerm lowercases a term and collapses its whitespace.
+func NormalizeSearchTerm(term string) string {
+	return strings.Join(strings.Fields(strings.ToLower(term)), " ")
+}
+
+// Validate normalizes the term and its synonyms, dropping duplicates.
+func (s *Synonym) Validate() error {
+	s.Term = NormalizeSearchTerm(s.Term)
+	if err := validateSearchTerm("term", s.Term); err != nil {
+		return err
+	}
+
+	synonyms := []string{}
+	for _, synonym := range s.Synonyms {
+		synonym = NormalizeSearchTerm(synonym)
+		if err := validateSearchTerm("synonyms", synonym); err != nil {
+			return err
+		}
+		if synonym != s.Term && !slices.Contains(synonyms, synonym) {
+			synonyms = append(synonyms, synonym)
+		}
+	}
+	if len(synonyms) == 0 || len(synonyms) > MaxSynonyms {
+		return &ValidationError{Field: "synonyms", Message: fmt.Sprintf("must have 1 to %d terms other than the term itself", MaxSynonyms)}
+	}
+	s.Synonyms = synonyms
+
+	return nil
+}
+
+// Search terms are quoted into websearch_to_tsquery input, so they can't hold quotes.
+func validateSearchTerm(field, term string) error {
+	switch {
+	case term == "":
+		return &ValidationError{Field: field, Message: "must not be empty"}
+	case len(term) > MaxSearchTermLength:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at most %d characters", MaxSearchTermLength)}
+	case strings.Contains(term, `"`):
+		return &ValidationError{Field: field, Message: "must not contain double quotes"}
+	}
+	return nil
+}
+
+// Validate normalizes the word. Stop words are matched as whole words in a regular
+// expression, so only letters and digits are allowed.
+func (w *StopWord) Validate() error {
+	w.Word = NormalizeSearchTerm(w.Word)
+	if !stopWordPattern.MatchString(w.Word) || len(w.Word) > MaxSearchTermLength {
+		return &ValidationError{Field: "word", Message: "must be a single word of letters and digits"}
+	}
+	return nil
+}
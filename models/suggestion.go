@@ -0,0 +1,20 @@
+package models
+
+// Suggestions are the search-as-you-type completions for a prefix.
+type Suggestions struct {
+	Titles     []string `json:"titles"`
+	Brands     []string `json:"brands"`
+	Categories []string `json:"categories"`
+}
+
+const (
+	DefaultSuggestLimit = 5
+	MaxSuggestLimit     = 20
+
+	// Shorter prefixes contain no trigram, so the GIN indexes can't serve the ILIKE
+	MinSuggestQueryChars = 3
+
+	// SuggestCandidatesPerTitle bounds the matching products read per title suggestion
+	// before duplicate titles are collapsed
+	SuggestCandidatesPerTitle = 10
+)
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError reports a product field that failed validation.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// RowValidationErrors reports every row of an all-or-nothing bulk write that failed
+// validation. Each Field is prefixed with the row's index, as in "[3].price".
+type RowValidationErrors struct {
+	Errors []ValidationError `json:"errors"`
+}
+
+func (e *RowValidationErrors) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		messages[i] = e.Errors[i].Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the fields a stored product must satisfy.
+func (p *Product) Validate() error {
+	switch {
+	case p.Title == "":
+		return &ValidationError{Field: "title", Message: "is required"}
+	case p.Price <= 0:
+		return &ValidationError{Field: "price", Message: "must be greater than 0"}
+	case p.Currency == "":
+		return &ValidationError{Field: "currency", Message: "is required"}
+	case p.Stock < 0:
+		return &ValidationError{Field: "stock", Message: "must not be negative"}
+	case p.AvgRating != nil && (*p.AvgRating < 0 || *p.AvgRating > 5):
+		return &ValidationError{Field: "avg_rating", Message: "must be between 0 and 5"}
+	case p.ReviewCount != nil && *p.ReviewCount < 0:
+		return &ValidationError{Field: "review_count", Message: "must not be negative"}
+	case p.BoughtInLastMonth != nil && *p.BoughtInLastMonth < 0:
+		return &ValidationError{Field: "bought_in_last_month", Message: "must not be negative"}
+	}
+	return nil
+}
+
+// PatchableFields are the JSON keys a PATCH may change. Each key is also the column name.
+var PatchableFields = map[string]bool{
+	"title":                true,
+	"asin":                 true,
+	"description":          true,
+	"category":             true,
+	"brand":                true,
+	"image_url":            true,
+	"product_url":          true,
+	"price":                true,
+	"currency":             true,
+	"country":              true,
+	"stock":                true,
+	"avg_rating":           true,
+	"review_count":         true,
+	"bought_in_last_month": true,
+	"is_best_seller":       true,
+}
+
+// NullableFields are the patchable fields whose columns accept NULL, which a PATCH
+// sets by sending JSON null.
+var NullableFields = map[string]bool{
+	"asin":                 true,
+	"description":          true,
+	"category":             true,
+	"brand":                true,
+	"image_url":            true,
+	"product_url":          true,
+	"country":              true,
+	"avg_rating":           true,
+	"review_count":         true,
+	"bought_in_last_month": true,
+}
+
+// ClearField resets a nullable field to its NULL value: "" for text columns, which
+// read back that way, and nil for numbers.
+func (p *Product) ClearField(field string) {
+	switch field {
+	case "asin":
+		p.ASIN = ""
+	case "description":
+		p.Description = ""
+	case "category":
+		p.Category = ""
+	case "brand":
+		p.Brand = ""
+	case "image_url":
+		p.ImageURL = ""
+	case "product_url":
+		p.ProductURL = ""
+	case "country":
+		p.Country = ""
+	case "avg_rating":
+		p.AvgRating = nil
+	case "review_count":
+		p.ReviewCount = nil
+	case "bought_in_last_month":
+		p.BoughtInLastMonth = nil
+	}
+}
@@ -0,0 +1,99 @@
+package models
+
+import "strings"
+
+type WriteStatus string
+
+const (
+	WriteCreated   WriteStatus = "created"
+	WriteUpdated   WriteStatus = "updated"
+	WriteUnchanged WriteStatus = "unchanged"
+)
+
+// ProductWriteResult is the outcome of writing one product.
+type ProductWriteResult struct {
+	Status  WriteStatus `json:"status"`
+	Product *Product    `json:"product"`
+}
+
+// UpsertOptions controls what an upsert overwrites when the ASIN already exists.
+// Columns not listed keep their stored values.
+type UpsertOptions struct {
+	Fields []string
+}
+
+// NewUpsertOptions parses a comma separated update_fields list. Empty overwrites
+// every patchable field except the ASIN itself.
+func NewUpsertOptions(updateFields string) (*UpsertOptions, error) {
+	fields := splitValues([]string{updateFields})
+
+	if len(fields) == 0 {
+		for field := range PatchableFields {
+			if field != "asin" {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if !PatchableFields[field] || field == "asin" {
+			return nil, &ValidationError{Field: "update_fields", Message: "unknown or immutable field " + field}
+		}
+	}
+
+	return &UpsertOptions{Fields: fields}, nil
+}
+
+// String lists the overwritten fields, for logging.
+func (o *UpsertOptions) String() string {
+	return strings.Join(o.Fields, ",")
+}
+
+// WriteFailed marks a bulk item that was not written; its BulkItemResult carries the error.
+const WriteFailed WriteStatus = "failed"
+
+type ItemErrorType string
+
+const (
+	ItemErrorValidation    ItemErrorType = "validation"
+	ItemErrorDuplicateASIN ItemErrorType = "duplicate_asin"
+	ItemErrorConstraint    ItemErrorType = "constraint"
+	ItemErrorDatabase      ItemErrorType = "database"
+)
+
+type BulkItemError struct {
+	Type    ItemErrorType `json:"type"`
+	Field   string        `json:"field,omitempty"`
+	Message string        `json:"message"`
+}
+
+// BulkItemResult reports one row of a partial-success bulk write, by its index in the request.
+type BulkItemResult struct {
+	Index   int            `json:"index"`
+	Status  WriteStatus    `json:"status"`
+	Product *Product       `json:"product,omitempty"`
+	Error   *BulkItemError `json:"error,omitempty"`
+}
+
+type BulkResult struct {
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+}
+
+// Add records an item and bumps the matching counter.
+func (r *BulkResult) Add(item BulkItemResult) {
+	switch item.Status {
+	case WriteCreated:
+		r.Created++
+	case WriteUpdated:
+		r.Updated++
+	case WriteUnchanged:
+		r.Unchanged++
+	case WriteFailed:
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
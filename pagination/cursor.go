@@ -0,0 +1,135 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed, forged, or were
+// issued for a different sort or filter.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the keyset position a next_cursor token carries. It is bound to the
+// sort and to a hash of the filter it was issued for.
+type Cursor struct {
+	Column     models.SortByEnum    `json:"c"`
+	Order      models.SortOrderEnum `json:"o"`
+	LastValue  *string              `json:"v"` // null when the row's sort column is NULL
+	LastID     int                  `json:"id"`
+	FilterHash string               `json:"f"`
+	Backward   bool                 `json:"b,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// Encode serialises and signs a cursor as "<payload>.<signature>", both base64url.
+func Encode(c Cursor) string {
+	payload, _ := json.Marshal(c)
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(sign(payload))
+}
+
+// Decode verifies a token's signature and returns the cursor it carries.
+func Decode(token string) (*Cursor, error) {
+	payloadPart, signaturePart, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := encoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := encoding.DecodeString(signaturePart)
+	if err != nil || !hmac.Equal(signature, sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, config.CursorSecret())
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// FilterHash fingerprints everything about a normalized filter that decides which
+// rows match and how they are ordered, leaving out the page position and size.
+func FilterHash(f *models.ProductFilter) string {
+	scoped := *f
+	scoped.Normalize()
+	scoped.Cursor = ""
+	scoped.SortLastValue = nil
+	scoped.LastID = models.DefaultLastID
+	scoped.Backward = false
+	scoped.PageSize = 0
+	scoped.PageNumber = models.DefaultPageNumber
+	scoped.IncludeFacets = false
+	scoped.PriceBuckets = 0
+	scoped.CountMode = ""
+	scoped.CountCap = 0
+
+	data, _ := json.Marshal(scoped)
+	sum := sha256.Sum256(data)
+	return encoding.EncodeToString(sum[:16])
+}
+
+// Apply checks a client cursor against the filter and, if it belongs to it, sets
+// the filter's keyset position. The filter must already be normalized.
+func Apply(f *models.ProductFilter, token string) error {
+	c, err := Decode(token)
+	if err != nil {
+		return err
+	}
+
+	if c.Column != f.SortByColumn || c.Order != f.SortOrder || c.FilterHash != FilterHash(f) {
+		return ErrInvalidCursor
+	}
+
+	f.SortLastValue = c.LastValue
+	f.LastID = c.LastID
+	f.Backward = c.Backward
+	return nil
+}
+
+// Next returns the cursor for the page after products, or "" when there is none or
+// the listing is offset paginated. hasMore is whether rows lie beyond the page in
+// the direction it was fetched.
+func Next(f *models.ProductFilter, products []models.Product, hasMore bool) string {
+	if len(products) == 0 || f.PageNumber > 0 || (!f.Backward && !hasMore) {
+		return ""
+	}
+	return encodeAt(f, products[len(products)-1], false)
+}
+
+// Prev returns the cursor for the page before products. The first page has none.
+func Prev(f *models.ProductFilter, products []models.Product, hasMore bool) string {
+	if len(products) == 0 || f.PageNumber > 0 || f.LastID == models.DefaultLastID {
+		return ""
+	}
+	if f.Backward && !hasMore {
+		return ""
+	}
+	return encodeAt(f, products[0], true)
+}
+
+func encodeAt(f *models.ProductFilter, p models.Product, backward bool) string {
+	return Encode(Cursor{
+		Column:     f.SortByColumn,
+		Order:      f.SortOrder,
+		LastValue:  p.SortValue(f.SortByColumn),
+		LastID:     p.ID,
+		FilterHash: FilterHash(f),
+		Backward:   backward,
+	})
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const insertReturningQuery = `
+	INSERT INTO products (title, asin, description, category, brand, image_url, product_url, price, currency, country, stock, avg_rating, review_count, bought_in_last_month, is_best_seller, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW(), NOW())
+	RETURNING ` + productColumns + `, 'created'`
+
+// CreateProductsPartial writes each product under its own savepoint so a bad row
+// only rolls back itself. Results line up with products by index. A nil opts
+// inserts; otherwise rows are upserted by ASIN.
+func (r *ProductRepository) CreateProductsPartial(
+	ctx context.Context,
+	products []models.Product,
+	opts *models.UpsertOptions,
+) ([]models.BulkItemResult, error) {
+
+	query := insertReturningQuery
+	if opts != nil {
+		query = upsertQuery(opts.Fields)
+	}
+
+	tx, err := config.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	results := make([]models.BulkItemResult, len(products))
+
+	for i := range products {
+		results[i].Index = i
+
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := scanWriteResult(savepoint.QueryRow(ctx, query, productInsertArgs(&products[i])...))
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) {
+				return nil, err
+			}
+			if err := savepoint.Rollback(ctx); err != nil {
+				return nil, err
+			}
+			results[i].Status = models.WriteFailed
+			results[i].Error = classifyPgError(pgErr)
+			continue
+		}
+
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, err
+		}
+		results[i].Status = result.Status
+		results[i].Product = result.Product
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Partial bulk write of %d products done", len(products))
+
+	return results, nil
+}
+
+// classifyPgError turns a per-row Postgres error into a client-facing item error.
+func classifyPgError(pgErr *pgconn.PgError) *models.BulkItemError {
+	itemErr := &models.BulkItemError{
+		Type:    models.ItemErrorDatabase,
+		Field:   pgErr.ColumnName,
+		Message: pgErr.Message,
+	}
+
+	switch {
+	case pgErr.Code == "23505" && pgErr.ConstraintName == "products_asin_key":
+		itemErr.Type = models.ItemErrorDuplicateASIN
+		itemErr.Field = "asin"
+	case pgErr.Code[:2] == "23":
+		// class 23: integrity constraint violation
+		itemErr.Type = models.ItemErrorConstraint
+	case pgErr.Code[:2] == "22":
+		// class 22: data exception, e.g. a value too long for its column
+		itemErr.Type = models.ItemErrorValidation
+	}
+
+	return itemErr
+}
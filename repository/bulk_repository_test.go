@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"ecommerce_product_listing/models"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestClassifyPgError(t *testing.T) {
+	tests := []struct {
+		name      string
+		pgErr     *pgconn.PgError
+		errorType models.ItemErrorType
+		field     string
+	}{
+		{"duplicate asin", &pgconn.PgError{Code: "23505", ConstraintName: "products_asin_key"}, models.ItemErrorDuplicateASIN, "asin"},
+		{"other unique key", &pgconn.PgError{Code: "23505", ConstraintName: "products_pkey"}, models.ItemErrorConstraint, ""},
+		{"not null", &pgconn.PgError{Code: "23502", ColumnName: "currency"}, models.ItemErrorConstraint, "currency"},
+		{"value too long", &pgconn.PgError{Code: "22001"}, models.ItemErrorValidation, ""},
+		{"other", &pgconn.PgError{Code: "40001"}, models.ItemErrorDatabase, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itemErr := classifyPgError(tt.pgErr)
+			if itemErr.Type != tt.errorType || itemErr.Field != tt.field {
+				t.Errorf("item error = %+v, want type %s field %q", itemErr, tt.errorType, tt.field)
+			}
+		})
+	}
+}
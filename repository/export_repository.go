@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"fmt"
+	"log"
+)
+
+// exportFetchSize is how many rows each FETCH pulls from the export cursor.
+const exportFetchSize = 1000
+
+// ExportProducts calls fn for every product matching the filter, in id order. Rows
+// are pulled through a server-side cursor so memory stays flat however many match;
+// pagination fields on the filter are ignored. Returning an error from fn stops the export.
+func (r *ProductRepository) ExportProducts(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+	fn func(p *models.Product) error,
+) error {
+	productFilter.Normalize()
+
+	query, args, err := buildSQL(exportQuery(productFilter))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Constructed SQL export query: %s", query)
+	log.Printf("With arguments: %v", args)
+
+	tx, err := config.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := applySearchSettings(ctx, tx, productFilter); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DECLARE export_cursor NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf(`FETCH %d FROM export_cursor`, exportFetchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var p models.Product
+			if err := rows.Scan(productScanDest(&p)...); err != nil {
+				rows.Close()
+				return err
+			}
+			fetched++
+			if err := fn(&p); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func exportQuery(productFilter *models.ProductFilter) sqlExpr {
+	return &selectQuery{
+		columns: []sqlExpr{sqlf(productColumns)},
+		from:    "products",
+		where:   filterExpr(productFilter, dimensionNone),
+		orderBy: []sqlExpr{sqlf("id")},
+	}
+}
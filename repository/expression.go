@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"ecommerce_product_listing/models"
+	"time"
+)
+
+// expressionSQL compiles a validated filter tree. Field names come from the
+// models.FilterFields whitelist and every value is bound as an argument.
+func expressionSQL(e *models.FilterExpression) sqlExpr {
+	switch {
+	case e.And != nil:
+		group := allOf()
+		for i := range e.And {
+			group.add(expressionSQL(&e.And[i]))
+		}
+		return group
+
+	case e.Or != nil:
+		group := anyOf()
+		for i := range e.Or {
+			group.add(expressionSQL(&e.Or[i]))
+		}
+		return group
+
+	case e.Not != nil:
+		// NULL comparisons are false, so their negation is true
+		return sqlf("($1) IS NOT TRUE", expressionSQL(e.Not))
+
+	case e.Eq != nil:
+		return sqlf("$1 = $2", expressionColumn(e.Eq.Field), e.Eq.Value)
+
+	case e.In != nil:
+		return sqlf("$1 = ANY($2)", expressionColumn(e.In.Field), typedValues(models.FilterFields[e.In.Field], e.In.Values))
+
+	case e.Range != nil:
+		column := expressionColumn(e.Range.Field)
+		group := allOf()
+		for _, bound := range []struct {
+			operator string
+			value    interface{}
+		}{
+			{">", e.Range.GT}, {">=", e.Range.GTE}, {"<", e.Range.LT}, {"<=", e.Range.LTE},
+		} {
+			if bound.value != nil {
+				group.add(sqlf("$1 "+bound.operator+" $2", column, bound.value))
+			}
+		}
+		return group
+
+	case e.Exists != nil:
+		column := expressionColumn(e.Exists.Field)
+		if models.FilterFields[e.Exists.Field] == models.TextField {
+			return allOf(sqlf("$1 IS NOT NULL", column), sqlf("$1 <> ''", column))
+		}
+		return sqlf("$1 IS NOT NULL", column)
+
+	case e.Match != nil:
+		if e.Match.Field == "" {
+			return sqlf("search_vector @@ $1", tsQueryExpression(param(e.Match.Query)))
+		}
+		return sqlf("$1 ILIKE $2", expressionColumn(e.Match.Field), "%"+likeEscaper.Replace(e.Match.Query)+"%")
+	}
+
+	return sqlf("")
+}
+
+func expressionColumn(field string) sqlExpr {
+	// is_best_seller defaults to false but the column is nullable
+	if field == "is_best_seller" {
+		return sqlf("coalesce(is_best_seller, false)")
+	}
+	return sqlf(field)
+}
+
+// typedValues converts validated values to a slice pgx can encode as an array.
+func typedValues(fieldType models.FieldType, values []interface{}) interface{} {
+	switch fieldType {
+	case models.NumberField:
+		return convertValues[float64](values)
+	case models.IntegerField:
+		return convertValues[int64](values)
+	case models.BoolField:
+		return convertValues[bool](values)
+	case models.TimeField:
+		return convertValues[time.Time](values)
+	}
+	return convertValues[string](values)
+}
+
+func convertValues[T any](values []interface{}) []T {
+	out := make([]T, len(values))
+	for i, value := range values {
+		out[i] = value.(T)
+	}
+	return out
+}
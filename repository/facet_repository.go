@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/models"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *ProductRepository) GetFacets(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+) (*models.Facets, error) {
+	productFilter.Normalize()
+
+	batch := &pgx.Batch{}
+	for _, query := range facetQueries(productFilter) {
+		sql, args, err := buildSQL(query)
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(sql, args...)
+	}
+
+	log.Printf("Queued %d facet queries", batch.Len())
+
+	facets := &models.Facets{}
+
+	err := withSearchSettings(ctx, productFilter, func(q querier) error {
+		br := q.SendBatch(ctx, batch)
+		defer br.Close()
+
+		for _, dest := range []*[]models.FacetCount{&facets.Categories, &facets.Brands} {
+			rows, err := br.Query()
+			if err != nil {
+				return err
+			}
+			counts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.FacetCount, error) {
+				var fc models.FacetCount
+				err := row.Scan(&fc.Value, &fc.Count)
+				return fc, err
+			})
+			if err != nil {
+				return err
+			}
+			*dest = counts
+		}
+
+		ratingValues := make([]int64, len(models.RatingFacetThresholds))
+		ratingDest := make([]interface{}, len(ratingValues))
+		for i := range ratingValues {
+			ratingDest[i] = &ratingValues[i]
+		}
+		if err := br.QueryRow().Scan(ratingDest...); err != nil {
+			return err
+		}
+		for i, threshold := range models.RatingFacetThresholds {
+			facets.Ratings = append(facets.Ratings, models.FacetCount{Value: strconv.Itoa(threshold), Count: ratingValues[i]})
+		}
+
+		var bestSeller, notBestSeller int64
+		if err := br.QueryRow().Scan(&bestSeller, &notBestSeller); err != nil {
+			return err
+		}
+		facets.BestSeller = []models.FacetCount{{Value: "true", Count: bestSeller}, {Value: "false", Count: notBestSeller}}
+
+		var inStock, outOfStock int64
+		if err := br.QueryRow().Scan(&inStock, &outOfStock); err != nil {
+			return err
+		}
+		facets.Stock = []models.FacetCount{{Value: "in_stock", Count: inStock}, {Value: "out_of_stock", Count: outOfStock}}
+
+		rows, err := br.Query()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		facets.Prices = []models.PriceHistogram{}
+		for rows.Next() {
+			var currency string
+			var lo, hi float64
+			var bucket int
+			var count int64
+			if err := rows.Scan(&currency, &lo, &hi, &bucket, &count); err != nil {
+				return err
+			}
+
+			n := len(facets.Prices)
+			if n == 0 || facets.Prices[n-1].Currency != currency {
+				facets.Prices = append(facets.Prices, newPriceHistogram(currency, lo, hi, productFilter.PriceBuckets))
+				n++
+			}
+			facets.Prices[n-1].Buckets[bucket-1].Count = count
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		return br.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// facetQueries builds the statements GetFacets batches, in the order it reads them.
+// Each facet is counted with its own dimension left out of the filter.
+func facetQueries(productFilter *models.ProductFilter) []sqlExpr {
+	queries := []sqlExpr{}
+	queue := func(query sqlExpr) {
+		queries = append(queries, query)
+	}
+
+	// Value facets: top values by count
+	for _, column := range []filterDimension{dimensionCategory, dimensionBrand} {
+		where := filterExpr(productFilter, column)
+		where.add(sqlf(string(column)+" IS NOT NULL"), sqlf(string(column)+" <> ''"))
+		queue(&selectQuery{
+			columns: []sqlExpr{sqlf(string(column)), sqlf("COUNT(*)")},
+			from:    "products",
+			where:   where,
+			groupBy: string(column),
+			orderBy: []sqlExpr{sqlf("COUNT(*) DESC"), sqlf(string(column))},
+			limit:   models.MaxFacetValues,
+		})
+	}
+
+	// Rating facet: cumulative "N stars & up" buckets
+	ratingCounts := []sqlExpr{}
+	for _, threshold := range models.RatingFacetThresholds {
+		ratingCounts = append(ratingCounts, sqlf(fmt.Sprintf("COUNT(*) FILTER (WHERE avg_rating >= %d)", threshold)))
+	}
+	queue(&selectQuery{columns: ratingCounts, from: "products", where: filterExpr(productFilter, dimensionRating)})
+
+	queue(&selectQuery{
+		columns: []sqlExpr{sqlf("COUNT(*) FILTER (WHERE is_best_seller)"), sqlf("COUNT(*) FILTER (WHERE NOT coalesce(is_best_seller, FALSE))")},
+		from:    "products",
+		where:   filterExpr(productFilter, dimensionBestSeller),
+	})
+
+	queue(&selectQuery{
+		columns: []sqlExpr{sqlf("COUNT(*) FILTER (WHERE stock > 0)"), sqlf("COUNT(*) FILTER (WHERE stock <= 0)")},
+		from:    "products",
+		where:   filterExpr(productFilter, dimensionStock),
+	})
+
+	// Price facet: equal-width buckets between each currency's min and max price.
+	// width_bucket puts the max itself in bucket n+1, so it is folded back into n.
+	filtered := &selectQuery{
+		columns: []sqlExpr{sqlf("currency, price")},
+		from:    "products",
+		where:   filterExpr(productFilter, dimensionPrice),
+	}
+	queue(sqlf(`
+	WITH filtered AS (
+		$1
+	), bounds AS (
+		SELECT currency, MIN(price) AS lo, MAX(price) AS hi FROM filtered GROUP BY currency
+	)
+	SELECT b.currency, b.lo::float8, b.hi::float8,
+		CASE WHEN b.hi = b.lo THEN 1 ELSE LEAST(width_bucket(f.price, b.lo, b.hi, $2), $2) END AS bucket,
+		COUNT(*)
+	FROM filtered f JOIN bounds b USING (currency)
+	GROUP BY b.currency, b.lo, b.hi, bucket
+	ORDER BY b.currency, bucket`, filtered, productFilter.PriceBuckets))
+
+	return queries
+}
+
+// newPriceHistogram lays out empty equal-width buckets over [lo, hi]. A single-price
+// currency gets one bucket.
+func newPriceHistogram(currency string, lo, hi float64, buckets int) models.PriceHistogram {
+	if hi == lo {
+		buckets = 1
+	}
+
+	width := (hi - lo) / float64(buckets)
+	histogram := models.PriceHistogram{
+		Currency: currency,
+		Min:      lo,
+		Max:      hi,
+		Buckets:  make([]models.PriceBucket, buckets),
+	}
+	for i := range histogram.Buckets {
+		histogram.Buckets[i].Min = lo + float64(i)*width
+		histogram.Buckets[i].Max = lo + float64(i+1)*width
+	}
+	histogram.Buckets[buckets-1].Max = hi
+
+	return histogram
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// stagingColumns are the products columns an import writes, in COPY order.
+var stagingColumns = []string{
+	"line", "title", "asin", "description", "category", "brand", "image_url", "product_url", "price",
+	"currency", "country", "stock", "avg_rating", "review_count", "bought_in_last_month", "is_best_seller",
+}
+
+const createStagingTable = `
+	CREATE TEMP TABLE products_staging (
+		line BIGINT,
+		title TEXT,
+		asin VARCHAR(255),
+		description TEXT,
+		category VARCHAR(255),
+		brand VARCHAR(255),
+		image_url TEXT,
+		product_url TEXT,
+		price NUMERIC(10, 2),
+		currency VARCHAR(10),
+		country VARCHAR(50),
+		stock INT,
+		avg_rating NUMERIC(3, 2),
+		review_count INT,
+		bought_in_last_month INT,
+		is_best_seller BOOLEAN
+	) ON COMMIT DROP`
+
+// ErrImportDecode wraps input that could not be read any further, as opposed to a
+// database failure. Lines that fail to decode are reported per row instead.
+var ErrImportDecode = errors.New("invalid import input")
+
+// stagingSource adapts a ProductSource to pgx.CopyFromSource. Rows failing
+// validation are counted and skipped instead of aborting the COPY.
+type stagingSource struct {
+	src    models.ProductSource
+	result *models.ImportResult
+	values []interface{}
+	err    error
+}
+
+func (s *stagingSource) Next() bool {
+	for {
+		p, line, err := s.src.Next()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil && !isRowDecodeError(err) {
+			s.err = errors.Join(ErrImportDecode, err)
+			return false
+		}
+		s.result.Received++
+
+		if err == nil {
+			err = p.Validate()
+		}
+		if err != nil {
+			recordInvalidRow(s.result, line, err)
+			continue
+		}
+
+		// Blank ASINs go in as NULL so they don't collide on the unique constraint
+		var asin interface{}
+		if p.ASIN != "" {
+			asin = p.ASIN
+		}
+
+		s.values = []interface{}{
+			line, p.Title, asin, p.Description, p.Category, p.Brand, p.ImageURL, p.ProductURL, p.Price,
+			p.Currency, p.Country, p.Stock, p.AvgRating, p.ReviewCount, p.BoughtInLastMonth, p.IsBestSeller,
+		}
+		return true
+	}
+}
+
+// recordInvalidRow counts a row that failed to decode or validate and lists it while
+// there is room.
+func recordInvalidRow(result *models.ImportResult, line int, err error) {
+	result.Invalid++
+	if len(result.Errors) >= models.MaxImportErrors {
+		return
+	}
+
+	rowErr := models.ImportRowError{Line: line, Message: err.Error()}
+	var validationErr *models.ValidationError
+	var decodeErr *models.RowDecodeError
+	switch {
+	case errors.As(err, &validationErr):
+		rowErr.Field, rowErr.Message = validationErr.Field, validationErr.Message
+	case errors.As(err, &decodeErr):
+		rowErr.Field, rowErr.Message = decodeErr.Field, decodeErr.Err.Error()
+	}
+	result.Errors = append(result.Errors, rowErr)
+}
+
+func isRowDecodeError(err error) bool {
+	var decodeErr *models.RowDecodeError
+	return errors.As(err, &decodeErr)
+}
+
+func (s *stagingSource) Values() ([]interface{}, error) { return s.values, nil }
+
+func (s *stagingSource) Err() error { return s.err }
+
+// ImportProducts streams src into a temp staging table with COPY, then merges it into
+// products in one statement. When an ASIN repeats, the last occurrence wins. A nil
+// opts skips existing ASINs; otherwise their listed fields are overwritten.
+func (r *ProductRepository) ImportProducts(
+	ctx context.Context,
+	src models.ProductSource,
+	opts *models.UpsertOptions,
+) (*models.ImportResult, error) {
+
+	start := time.Now()
+	result := &models.ImportResult{}
+
+	tx, err := config.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createStagingTable); err != nil {
+		return nil, err
+	}
+
+	source := &stagingSource{src: src, result: result}
+	staged, err := tx.CopyFrom(ctx, pgx.Identifier{"products_staging"}, stagingColumns, source)
+	if err != nil {
+		return nil, err
+	}
+
+	onConflict := "ON CONFLICT (asin) DO NOTHING"
+	if opts != nil {
+		onConflict = onConflictUpdate(opts.Fields)
+	}
+
+	merge := `
+	WITH merged AS (
+		INSERT INTO products (title, asin, description, category, brand, image_url, product_url, price, currency, country, stock, avg_rating, review_count, bought_in_last_month, is_best_seller, created_at, updated_at)
+		SELECT DISTINCT ON (coalesce(asin, 'line:' || line))
+			title, asin, description, category, brand, image_url, product_url, price, currency, country, stock, avg_rating, review_count, bought_in_last_month, is_best_seller, NOW(), NOW()
+		FROM products_staging
+		ORDER BY coalesce(asin, 'line:' || line), line DESC
+		` + onConflict + `
+		RETURNING (xmax = 0) AS inserted
+	)
+	SELECT COUNT(*) FILTER (WHERE inserted), COUNT(*) FILTER (WHERE NOT inserted) FROM merged`
+
+	if err := tx.QueryRow(ctx, merge).Scan(&result.Inserted, &result.Updated); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	result.Unchanged = staged - result.Inserted - result.Updated
+	elapsed := time.Since(start)
+	result.DurationMS = elapsed.Milliseconds()
+	if elapsed > 0 {
+		result.RowsPerSecond = float64(result.Received) / elapsed.Seconds()
+	}
+
+	log.Printf("Imported %d rows (%d inserted, %d updated, %d invalid) in %s at %.0f rows/s",
+		result.Received, result.Inserted, result.Updated, result.Invalid, elapsed, result.RowsPerSecond)
+
+	return result, nil
+}
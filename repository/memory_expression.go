@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"cmp"
+	"ecommerce_product_listing/models"
+	"strings"
+	"time"
+)
+
+// evalExpression mirrors expressionSQL. A comparison with a missing value is false,
+// so "not" of it is true, as with the SQL's IS NOT TRUE.
+func evalExpression(e *models.FilterExpression, p *models.Product, dictionary *searchDictionary) bool {
+	switch {
+	case e.And != nil:
+		for i := range e.And {
+			if !evalExpression(&e.And[i], p, dictionary) {
+				return false
+			}
+		}
+		return true
+
+	case e.Or != nil:
+		for i := range e.Or {
+			if evalExpression(&e.Or[i], p, dictionary) {
+				return true
+			}
+		}
+		return false
+
+	case e.Not != nil:
+		return !evalExpression(e.Not, p, dictionary)
+
+	case e.Eq != nil:
+		value, ok := fieldValue(p, e.Eq.Field)
+		return ok && compareFieldValues(value, e.Eq.Value) == 0
+
+	case e.In != nil:
+		value, ok := fieldValue(p, e.In.Field)
+		if !ok {
+			return false
+		}
+		for _, candidate := range e.In.Values {
+			if compareFieldValues(value, candidate) == 0 {
+				return true
+			}
+		}
+		return false
+
+	case e.Range != nil:
+		value, ok := fieldValue(p, e.Range.Field)
+		if !ok {
+			return false
+		}
+		r := e.Range
+		return (r.GT == nil || compareFieldValues(value, r.GT) > 0) &&
+			(r.GTE == nil || compareFieldValues(value, r.GTE) >= 0) &&
+			(r.LT == nil || compareFieldValues(value, r.LT) < 0) &&
+			(r.LTE == nil || compareFieldValues(value, r.LTE) <= 0)
+
+	case e.Exists != nil:
+		value, ok := fieldValue(p, e.Exists.Field)
+		return ok && value != ""
+
+	case e.Match != nil:
+		if e.Match.Field == "" {
+			return parseWebSearch(e.Match.Query, dictionary).matches(newSearchDocument(p.Title, p.Description).all)
+		}
+		value, _ := fieldValue(p, e.Match.Field)
+		text, _ := value.(string)
+		return strings.Contains(strings.ToLower(text), strings.ToLower(e.Match.Query))
+	}
+
+	return false
+}
+
+// fieldValue returns a whitelisted field as the type models.FilterExpression.Validate
+// coerces to, or false when the product has no value for it.
+func fieldValue(p *models.Product, field string) (interface{}, bool) {
+	switch field {
+	case "id":
+		return int64(p.ID), true
+	case "title":
+		return p.Title, true
+	case "asin":
+		return p.ASIN, true
+	case "description":
+		return p.Description, true
+	case "category":
+		return p.Category, true
+	case "brand":
+		return p.Brand, true
+	case "currency":
+		return p.Currency, true
+	case "country":
+		return p.Country, true
+	case "price":
+		return p.Price, true
+	case "avg_rating":
+		if p.AvgRating != nil {
+			return *p.AvgRating, true
+		}
+	case "stock":
+		return int64(p.Stock), true
+	case "review_count":
+		if p.ReviewCount != nil {
+			return int64(*p.ReviewCount), true
+		}
+	case "bought_in_last_month":
+		if p.BoughtInLastMonth != nil {
+			return int64(*p.BoughtInLastMonth), true
+		}
+	case "is_best_seller":
+		return p.IsBestSeller, true
+	case "created_at":
+		if p.CreatedAt != nil {
+			return *p.CreatedAt, true
+		}
+	case "updated_at":
+		if p.UpdatedAt != nil {
+			return *p.UpdatedAt, true
+		}
+	}
+	return nil, false
+}
+
+// compareFieldValues orders two values of the same field type; bools compare false
+// before true.
+func compareFieldValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bool:
+		switch b := b.(bool); {
+		case a == b:
+			return 0
+		case b:
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,1036 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"ecommerce_product_listing/models"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryProductRepository is a ProductStore held in process memory, for running the
+// API without Postgres. It follows ProductRepository's filter, sort, soft delete and
+// pagination semantics; text search matching and scores are approximations.
+type MemoryProductRepository struct {
+	mu     sync.RWMutex
+	rows   []*memoryRow // ascending id
+	byASIN map[string]*memoryRow
+	nextID int
+
+	synonyms   map[string]models.Synonym
+	stopWords  map[string]models.StopWord
+	dictionary *searchDictionary // compiled from synonyms and stopWords on first use after an edit
+}
+
+type memoryRow struct {
+	product   models.Product
+	deletedAt *time.Time
+}
+
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{
+		byASIN:    map[string]*memoryRow{},
+		nextID:    1,
+		synonyms:  map[string]models.Synonym{},
+		stopWords: map[string]models.StopWord{},
+	}
+}
+
+func (r *MemoryProductRepository) CreateProduct(
+	ctx context.Context,
+	p *models.Product,
+) (*models.Product, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.insertLocked(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *MemoryProductRepository) CreateProductsBulk(
+	ctx context.Context,
+	products []models.Product,
+) ([]models.Product, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// All or nothing, like the Postgres transaction
+	seen := map[string]bool{}
+	for i := range products {
+		asin := products[i].ASIN
+		if asin != "" && (seen[asin] || r.byASIN[asin] != nil) {
+			return nil, fmt.Errorf("product %d: %w", i, ErrDuplicateASIN)
+		}
+		seen[asin] = true
+	}
+
+	for i := range products {
+		if err := r.insertLocked(&products[i]); err != nil {
+			return nil, err
+		}
+	}
+	return products, nil
+}
+
+func (r *MemoryProductRepository) CreateProductsPartial(
+	ctx context.Context,
+	products []models.Product,
+	opts *models.UpsertOptions,
+) ([]models.BulkItemResult, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]models.BulkItemResult, len(products))
+	for i := range products {
+		results[i].Index = i
+		p := products[i]
+
+		if opts != nil {
+			result := r.upsertLocked(&p, opts.Fields)
+			results[i].Status, results[i].Product = result.Status, result.Product
+			continue
+		}
+
+		if err := r.insertLocked(&p); err != nil {
+			results[i].Status = models.WriteFailed
+			results[i].Error = &models.BulkItemError{Type: models.ItemErrorDuplicateASIN, Field: "asin", Message: err.Error()}
+			continue
+		}
+		results[i].Status, results[i].Product = models.WriteCreated, &p
+	}
+
+	return results, nil
+}
+
+func (r *MemoryProductRepository) UpsertProduct(
+	ctx context.Context,
+	p *models.Product,
+	opts *models.UpsertOptions,
+) (*models.ProductWriteResult, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.upsertLocked(p, opts.Fields), nil
+}
+
+func (r *MemoryProductRepository) UpsertProductsBulk(
+	ctx context.Context,
+	products []models.Product,
+	opts *models.UpsertOptions,
+) ([]models.ProductWriteResult, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]models.ProductWriteResult, 0, len(products))
+	for i := range products {
+		p := products[i]
+		results = append(results, *r.upsertLocked(&p, opts.Fields))
+	}
+	return results, nil
+}
+
+// ImportProducts reads all of src before writing, so an unreadable input leaves the
+// store untouched as the Postgres transaction would.
+func (r *MemoryProductRepository) ImportProducts(
+	ctx context.Context,
+	src models.ProductSource,
+	opts *models.UpsertOptions,
+) (*models.ImportResult, error) {
+
+	start := time.Now()
+	result := &models.ImportResult{}
+
+	staged := []*models.Product{}
+	for {
+		p, line, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !isRowDecodeError(err) {
+			return nil, errors.Join(ErrImportDecode, err)
+		}
+		result.Received++
+
+		if err == nil {
+			err = p.Validate()
+		}
+		if err != nil {
+			recordInvalidRow(result, line, err)
+			continue
+		}
+		staged = append(staged, p)
+	}
+
+	// When an ASIN repeats, the last occurrence wins
+	last := map[string]int{}
+	for i, p := range staged {
+		if p.ASIN != "" {
+			last[p.ASIN] = i
+		}
+	}
+
+	r.mu.Lock()
+	for i, p := range staged {
+		switch {
+		case p.ASIN != "" && last[p.ASIN] != i:
+		case p.ASIN == "" || r.byASIN[p.ASIN] == nil:
+			r.insertLocked(p)
+			result.Inserted++
+		case opts != nil:
+			if r.upsertLocked(p, opts.Fields).Status == models.WriteUpdated {
+				result.Updated++
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	result.Unchanged = int64(len(staged)) - result.Inserted - result.Updated
+	elapsed := time.Since(start)
+	result.DurationMS = elapsed.Milliseconds()
+	if elapsed > 0 {
+		result.RowsPerSecond = float64(result.Received) / elapsed.Seconds()
+	}
+
+	log.Printf("Imported %d rows into memory (%d inserted, %d updated, %d invalid) in %s",
+		result.Received, result.Inserted, result.Updated, result.Invalid, elapsed)
+
+	return result, nil
+}
+
+// GetProducts returns a page of products and whether more rows follow it in the
+// direction of travel (backward pages report rows before them).
+func (r *MemoryProductRepository) GetProducts(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+) ([]models.Product, bool, error) {
+
+	productFilter.Normalize()
+
+	q, err := newMemoryQuery(productFilter, r.searchDictionary())
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.mu.RLock()
+	matched := r.collectLocked(q, dimensionNone)
+	r.mu.RUnlock()
+
+	for i := range matched {
+		q.score(&matched[i])
+	}
+
+	column := productFilter.SortByColumn
+	descending := productFilter.SortOrder == models.SortOrderDesc
+	slices.SortFunc(matched, func(a, b models.Product) int {
+		return compareListing(memorySortKey(&a, column), a.ID, memorySortKey(&b, column), b.ID, descending)
+	})
+
+	backward := productFilter.Backward && productFilter.PageNumber <= 0
+
+	switch {
+	case productFilter.PageNumber > 0:
+		offset := min((productFilter.PageNumber-1)*productFilter.PageSize, len(matched))
+		matched = matched[offset:]
+
+	case productFilter.LastID != -1 && productFilter.PageNumber == -1:
+		cursor, err := cursorSortKey(productFilter)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid cursor value for %s: %w", column, err)
+		}
+		position := func(i int) int {
+			return compareListing(memorySortKey(&matched[i], column), matched[i].ID, cursor, productFilter.LastID, descending)
+		}
+
+		if backward {
+			matched = matched[:sort.Search(len(matched), func(i int) bool { return position(i) >= 0 })]
+			slices.Reverse(matched)
+		} else {
+			matched = matched[sort.Search(len(matched), func(i int) bool { return position(i) > 0 }):]
+		}
+	}
+
+	hasMore := len(matched) > productFilter.PageSize
+	if hasMore {
+		matched = matched[:productFilter.PageSize]
+	}
+
+	if backward {
+		slices.Reverse(matched)
+	}
+
+	return matched, hasMore, nil
+}
+
+// GetCounts counts exactly in every mode; the estimate mode only labels the result.
+func (r *MemoryProductRepository) GetCounts(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+) (*models.Count, error) {
+	productFilter.Normalize()
+
+	q, err := newMemoryQuery(productFilter, r.searchDictionary())
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	count := int64(len(r.collectLocked(q, dimensionNone)))
+	r.mu.RUnlock()
+
+	if productFilter.CountMode == models.CappedCountMode && count > int64(productFilter.CountCap) {
+		return models.NewCount(int64(productFilter.CountCap), models.CappedCountMode, true), nil
+	}
+	return models.NewCount(count, productFilter.CountMode, false), nil
+}
+
+func (r *MemoryProductRepository) GetFacets(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+) (*models.Facets, error) {
+	productFilter.Normalize()
+
+	q, err := newMemoryQuery(productFilter, r.searchDictionary())
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	facets := &models.Facets{
+		Categories: topValues(r.collectLocked(q, dimensionCategory), func(p *models.Product) string { return p.Category }, models.MaxFacetValues),
+		Brands:     topValues(r.collectLocked(q, dimensionBrand), func(p *models.Product) string { return p.Brand }, models.MaxFacetValues),
+	}
+
+	rated := r.collectLocked(q, dimensionRating)
+	for _, threshold := range models.RatingFacetThresholds {
+		var count int64
+		for i := range rated {
+			if rated[i].AvgRating != nil && *rated[i].AvgRating >= float64(threshold) {
+				count++
+			}
+		}
+		facets.Ratings = append(facets.Ratings, models.FacetCount{Value: strconv.Itoa(threshold), Count: count})
+	}
+
+	var bestSeller, notBestSeller int64
+	for _, p := range r.collectLocked(q, dimensionBestSeller) {
+		if p.IsBestSeller {
+			bestSeller++
+		} else {
+			notBestSeller++
+		}
+	}
+	facets.BestSeller = []models.FacetCount{{Value: "true", Count: bestSeller}, {Value: "false", Count: notBestSeller}}
+
+	var inStock, outOfStock int64
+	for _, p := range r.collectLocked(q, dimensionStock) {
+		if p.Stock > 0 {
+			inStock++
+		} else {
+			outOfStock++
+		}
+	}
+	facets.Stock = []models.FacetCount{{Value: "in_stock", Count: inStock}, {Value: "out_of_stock", Count: outOfStock}}
+
+	byCurrency := map[string][]float64{}
+	for _, p := range r.collectLocked(q, dimensionPrice) {
+		byCurrency[p.Currency] = append(byCurrency[p.Currency], p.Price)
+	}
+	currencies := make([]string, 0, len(byCurrency))
+	for currency := range byCurrency {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	facets.Prices = []models.PriceHistogram{}
+	for _, currency := range currencies {
+		prices := byCurrency[currency]
+		lo, hi := slices.Min(prices), slices.Max(prices)
+		histogram := newPriceHistogram(currency, lo, hi, productFilter.PriceBuckets)
+		for _, price := range prices {
+			bucket := 1
+			if hi > lo {
+				bucket = min(int(math.Floor((price-lo)/(hi-lo)*float64(len(histogram.Buckets))))+1, len(histogram.Buckets))
+			}
+			histogram.Buckets[bucket-1].Count++
+		}
+		facets.Prices = append(facets.Prices, histogram)
+	}
+
+	return facets, nil
+}
+
+func (r *MemoryProductRepository) Suggest(
+	ctx context.Context,
+	prefix string,
+	limit int,
+) (*models.Suggestions, error) {
+
+	needle := strings.ToLower(prefix)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var titled, branded, categorised []models.Product
+	for _, row := range r.rows {
+		p := &row.product
+		if row.deletedAt != nil || p.Stock <= 0 {
+			continue
+		}
+		if strings.Contains(strings.ToLower(p.Title), needle) {
+			titled = append(titled, *p)
+		}
+		if strings.HasPrefix(strings.ToLower(p.Brand), needle) {
+			branded = append(branded, *p)
+		}
+		if strings.HasPrefix(strings.ToLower(p.Category), needle) {
+			categorised = append(categorised, *p)
+		}
+	}
+
+	slices.SortFunc(titled, func(a, b models.Product) int {
+		return compareListing(memorySortKey(&a, models.SortByPopularity), a.ID, memorySortKey(&b, models.SortByPopularity), b.ID, true)
+	})
+
+	suggestions := &models.Suggestions{Titles: []string{}, Brands: []string{}, Categories: []string{}}
+	for i, p := range titled {
+		if len(suggestions.Titles) == limit || i == limit*models.SuggestCandidatesPerTitle {
+			break
+		}
+		if !slices.Contains(suggestions.Titles, p.Title) {
+			suggestions.Titles = append(suggestions.Titles, p.Title)
+		}
+	}
+	for _, fc := range topValues(branded, func(p *models.Product) string { return p.Brand }, limit) {
+		suggestions.Brands = append(suggestions.Brands, fc.Value)
+	}
+	for _, fc := range topValues(categorised, func(p *models.Product) string { return p.Category }, limit) {
+		suggestions.Categories = append(suggestions.Categories, fc.Value)
+	}
+
+	return suggestions, nil
+}
+
+func (r *MemoryProductRepository) GetVocabulary(ctx context.Context) (*models.Vocabulary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	brands, categories, currencies := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, row := range r.rows {
+		if row.deletedAt != nil {
+			continue
+		}
+		brands[row.product.Brand] = true
+		categories[row.product.Category] = true
+		currencies[row.product.Currency] = true
+	}
+
+	return &models.Vocabulary{
+		Brands:     vocabularyValues(brands),
+		Categories: vocabularyValues(categories),
+		Currencies: vocabularyValues(currencies),
+	}, nil
+}
+
+func vocabularyValues(set map[string]bool) []string {
+	delete(set, "")
+	return slices.Sorted(maps.Keys(set))
+}
+
+// ExportProducts calls fn for every product matching the filter, in id order, from a
+// snapshot taken up front so fn runs without holding the store lock.
+func (r *MemoryProductRepository) ExportProducts(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+	fn func(p *models.Product) error,
+) error {
+	productFilter.Normalize()
+
+	q, err := newMemoryQuery(productFilter, r.searchDictionary())
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	matched := r.collectLocked(q, dimensionNone)
+	r.mu.RUnlock()
+
+	for i := range matched {
+		if err := fn(&matched[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryProductRepository) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	row := r.findLocked(id)
+	if row == nil || row.deletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+	p := cloneProduct(&row.product)
+	return &p, nil
+}
+
+func (r *MemoryProductRepository) GetProductByASIN(ctx context.Context, asin string) (*models.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	row := r.byASIN[asin]
+	if row == nil || row.deletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+	p := cloneProduct(&row.product)
+	return &p, nil
+}
+
+func (r *MemoryProductRepository) UpdateProduct(
+	ctx context.Context,
+	id int,
+	p *models.Product,
+) (*models.Product, error) {
+
+	columns := make([]string, 0, len(models.PatchableFields))
+	for field := range models.PatchableFields {
+		columns = append(columns, field)
+	}
+	return r.PatchProduct(ctx, id, columns, p)
+}
+
+// PatchProduct updates only the given columns, taking their values from p.
+func (r *MemoryProductRepository) PatchProduct(
+	ctx context.Context,
+	id int,
+	columns []string,
+	p *models.Product,
+) (*models.Product, error) {
+
+	for _, column := range columns {
+		if !models.PatchableFields[column] {
+			return nil, fmt.Errorf("unsupported patch column: %s", column)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	row := r.findLocked(id)
+	if row == nil || row.deletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+
+	if slices.Contains(columns, "asin") && p.ASIN != row.product.ASIN {
+		if p.ASIN != "" && r.byASIN[p.ASIN] != nil {
+			return nil, ErrDuplicateASIN
+		}
+		delete(r.byASIN, row.product.ASIN)
+		if p.ASIN != "" {
+			r.byASIN[p.ASIN] = row
+		}
+	}
+
+	applyFields(&row.product, p, columns)
+	row.product.UpdatedAt = memoryNow()
+
+	updated := cloneProduct(&row.product)
+	return &updated, nil
+}
+
+// SoftDeleteProduct hides a product from every read until it is restored.
+func (r *MemoryProductRepository) SoftDeleteProduct(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	row := r.findLocked(id)
+	if row == nil || row.deletedAt != nil {
+		return ErrProductNotFound
+	}
+	row.deletedAt = memoryNow()
+	return nil
+}
+
+func (r *MemoryProductRepository) RestoreProduct(ctx context.Context, id int) (*models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	row := r.findLocked(id)
+	if row == nil || row.deletedAt == nil {
+		return nil, ErrProductNotFound
+	}
+	row.deletedAt = nil
+	row.product.UpdatedAt = memoryNow()
+
+	p := cloneProduct(&row.product)
+	return &p, nil
+}
+
+// PurgeProduct permanently removes a product, deleted or not.
+func (r *MemoryProductRepository) PurgeProduct(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, found := slices.BinarySearchFunc(r.rows, id, func(row *memoryRow, id int) int {
+		return cmp.Compare(row.product.ID, id)
+	})
+	if !found {
+		return ErrProductNotFound
+	}
+	delete(r.byASIN, r.rows[i].product.ASIN)
+	r.rows = slices.Delete(r.rows, i, i+1)
+	return nil
+}
+
+func (r *MemoryProductRepository) findLocked(id int) *memoryRow {
+	i, found := slices.BinarySearchFunc(r.rows, id, func(row *memoryRow, id int) int {
+		return cmp.Compare(row.product.ID, id)
+	})
+	if !found {
+		return nil
+	}
+	return r.rows[i]
+}
+
+// insertLocked stores a copy of p as a new row and fills in p's generated columns.
+func (r *MemoryProductRepository) insertLocked(p *models.Product) error {
+	if p.ASIN != "" && r.byASIN[p.ASIN] != nil {
+		return ErrDuplicateASIN
+	}
+
+	now := memoryNow()
+	p.ID = r.nextID
+	p.CreatedAt, p.UpdatedAt = now, now
+	r.nextID++
+
+	row := &memoryRow{product: cloneProduct(p)}
+	r.rows = append(r.rows, row)
+	if p.ASIN != "" {
+		r.byASIN[p.ASIN] = row
+	}
+	return nil
+}
+
+// upsertLocked inserts p or overwrites fields of the row holding its ASIN the way
+// ON CONFLICT (asin) does, restoring the row if it was deleted.
+func (r *MemoryProductRepository) upsertLocked(p *models.Product, fields []string) *models.ProductWriteResult {
+	row := r.byASIN[p.ASIN]
+	if row == nil {
+		r.insertLocked(p)
+		created := cloneProduct(p)
+		return &models.ProductWriteResult{Status: models.WriteCreated, Product: &created}
+	}
+
+	status := models.WriteUnchanged
+	if applyFields(&row.product, p, fields) || row.deletedAt != nil {
+		row.deletedAt = nil
+		row.product.UpdatedAt = memoryNow()
+		status = models.WriteUpdated
+	}
+
+	stored := cloneProduct(&row.product)
+	return &models.ProductWriteResult{Status: status, Product: &stored}
+}
+
+// collectLocked copies out the live products matching the filter without the
+// conditions of skip, in id order.
+func (r *MemoryProductRepository) collectLocked(q *memoryQuery, skip filterDimension) []models.Product {
+	matched := []models.Product{}
+	for _, row := range r.rows {
+		if row.deletedAt == nil && q.matches(&row.product, skip) {
+			matched = append(matched, cloneProduct(&row.product))
+		}
+	}
+	return matched
+}
+
+// memoryQuery is a ProductFilter prepared for evaluation against stored products.
+type memoryQuery struct {
+	filter     *models.ProductFilter
+	dictionary *searchDictionary
+	webSearch  *webSearchQuery
+	terms      map[string]bool
+	bounds     []timeBound
+}
+
+type timeBound struct {
+	field  func(p *models.Product) *time.Time
+	at     time.Time
+	before bool // exclusive upper bound; otherwise an inclusive lower bound
+}
+
+func newMemoryQuery(productFilter *models.ProductFilter, dictionary *searchDictionary) (*memoryQuery, error) {
+	q := &memoryQuery{filter: productFilter, dictionary: dictionary}
+
+	if productFilter.SearchQueryText != "" &&
+		(productFilter.SearchType == models.VectorSearchType || productFilter.SearchType == models.SearchEngineSearchType) {
+		q.webSearch = parseWebSearch(productFilter.SearchQueryText, dictionary)
+		q.terms = q.webSearch.terms()
+	}
+
+	created := func(p *models.Product) *time.Time { return p.CreatedAt }
+	updated := func(p *models.Product) *time.Time { return p.UpdatedAt }
+	for _, bound := range []struct {
+		field  func(p *models.Product) *time.Time
+		value  string
+		before bool
+	}{
+		{created, productFilter.CreatedAfter, false},
+		{created, productFilter.CreatedBefore, true},
+		{updated, productFilter.UpdatedSince, false},
+		{updated, productFilter.UpdatedBefore, true},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		at, err := models.ParseFilterTime(bound.value)
+		if err != nil {
+			return nil, err
+		}
+		q.bounds = append(q.bounds, timeBound{field: bound.field, at: at, before: bound.before})
+	}
+
+	return q, nil
+}
+
+// matches mirrors filterExpr.
+func (q *memoryQuery) matches(p *models.Product, skip filterDimension) bool {
+	f := q.filter
+
+	if f.SearchQueryText != "" {
+		switch f.SearchType {
+		case models.SimpleTextSearchType:
+			needle := strings.ToLower(f.SearchQueryText)
+			if !strings.Contains(strings.ToLower(p.Title), needle) && !strings.Contains(strings.ToLower(p.Description), needle) {
+				return false
+			}
+		case models.VectorSearchType, models.SearchEngineSearchType:
+			if !q.webSearch.matches(newSearchDocument(p.Title, p.Description).all) {
+				return false
+			}
+		case models.FuzzySearchType:
+			if similarity(f.SearchQueryText, p) < f.FuzzyThreshold {
+				return false
+			}
+		}
+	}
+
+	if skip != dimensionCategory {
+		if len(f.Category) > 0 && !slices.Contains(f.Category, p.Category) {
+			return false
+		}
+		if slices.Contains(f.CategoryNot, p.Category) {
+			return false
+		}
+	}
+
+	if skip != dimensionBrand {
+		if len(f.Brand) > 0 && !slices.Contains(f.Brand, p.Brand) {
+			return false
+		}
+		if slices.Contains(f.BrandNot, p.Brand) {
+			return false
+		}
+	}
+
+	if skip != dimensionPrice {
+		if f.MinPrice != -1 && p.Price < f.MinPrice {
+			return false
+		}
+		if f.MaxPrice != -1 && p.Price > f.MaxPrice {
+			return false
+		}
+	}
+
+	if !f.ShowOutOfStock && skip != dimensionStock && p.Stock <= 0 {
+		return false
+	}
+
+	if f.RatingMoreThanEqual > 0 && skip != dimensionRating &&
+		(p.AvgRating == nil || *p.AvgRating < f.RatingMoreThanEqual) {
+		return false
+	}
+
+	if f.ReviewCount > 0 && (p.ReviewCount == nil || *p.ReviewCount < f.ReviewCount) {
+		return false
+	}
+
+	if f.IsBestSeller != nil && skip != dimensionBestSeller && p.IsBestSeller != *f.IsBestSeller {
+		return false
+	}
+
+	if len(f.Country) > 0 && !slices.Contains(f.Country, p.Country) {
+		return false
+	}
+	if len(f.Currency) > 0 && !slices.Contains(f.Currency, p.Currency) {
+		return false
+	}
+
+	for _, bound := range q.bounds {
+		t := bound.field(p)
+		if t == nil || (bound.before && !t.Before(bound.at)) || (!bound.before && t.Before(bound.at)) {
+			return false
+		}
+	}
+
+	if f.Expression != nil && !evalExpression(f.Expression, p, q.dictionary) {
+		return false
+	}
+
+	return true
+}
+
+// score fills in the computed columns GetProducts selects for the filter.
+func (q *memoryQuery) score(p *models.Product) {
+	f := q.filter
+	if f.SearchQueryText == "" {
+		return
+	}
+
+	if f.SearchType == models.SearchEngineSearchType {
+		rank := newSearchDocument(p.Title, p.Description).rank(q.terms)
+		p.Rank = &rank
+		p.TitleHighlight = highlight(p.Title, q.terms)
+		p.DescriptionHighlight = highlight(p.Description, q.terms)
+	}
+
+	if f.SearchType == models.FuzzySearchType {
+		s := similarity(f.SearchQueryText, p)
+		p.Similarity = &s
+	}
+
+	if f.SortByColumn == models.SortByRelevance {
+		popularity, rating := 0.0, 0.0
+		if p.BoughtInLastMonth != nil {
+			popularity = float64(*p.BoughtInLastMonth)
+		}
+		if p.AvgRating != nil {
+			rating = *p.AvgRating
+		}
+		relevance := newSearchDocument(p.Title, p.Description).rank(q.terms) *
+			(1 + f.RelevancePopularityWeight*math.Log(1+popularity) + f.RelevanceRatingWeight*rating/5)
+		p.Relevance = &relevance
+	}
+}
+
+func similarity(query string, p *models.Product) float64 {
+	return max(wordSimilarity(query, p.Title), wordSimilarity(query, p.Description))
+}
+
+// sortKey is a row's sort column value; updated_at is held as Unix microseconds,
+// the precision Postgres stores.
+type sortKey struct {
+	value float64
+	null  bool
+}
+
+func memorySortKey(p *models.Product, column models.SortByEnum) sortKey {
+	var value *float64
+	switch column {
+	case models.SortByPrice:
+		value = &p.Price
+	case models.SortByPopularity:
+		if p.BoughtInLastMonth != nil {
+			v := float64(*p.BoughtInLastMonth)
+			value = &v
+		}
+	case models.SortByRating:
+		value = p.AvgRating
+	case models.SortByModificationDate:
+		if p.UpdatedAt != nil {
+			v := float64(p.UpdatedAt.UnixMicro())
+			value = &v
+		}
+	case models.SortByRank:
+		value = p.Rank
+	case models.SortByRelevance:
+		value = p.Relevance
+	case models.SortBySimilarity:
+		value = p.Similarity
+	}
+
+	if value == nil {
+		return sortKey{null: true}
+	}
+	return sortKey{value: *value}
+}
+
+func cursorSortKey(productFilter *models.ProductFilter) (sortKey, error) {
+	if productFilter.SortLastValue == nil {
+		return sortKey{null: true}, nil
+	}
+
+	value := *productFilter.SortLastValue
+	switch productFilter.SortByColumn {
+	case models.SortByModificationDate:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		return sortKey{value: float64(t.UnixMicro())}, err
+	case models.SortByPopularity:
+		n, err := strconv.Atoi(value)
+		return sortKey{value: float64(n)}, err
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	return sortKey{value: f}, err
+}
+
+// compareListing orders two rows as the listing does: sort value with NULLs last,
+// then id, both in the filter's direction.
+func compareListing(a sortKey, aID int, b sortKey, bID int, descending bool) int {
+	switch {
+	case a.null && !b.null:
+		return 1
+	case !a.null && b.null:
+		return -1
+	}
+
+	c := 0
+	if !a.null {
+		c = cmp.Compare(a.value, b.value)
+	}
+	if c == 0 {
+		c = cmp.Compare(aID, bID)
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// topValues counts products per non-empty value, most common first.
+func topValues(products []models.Product, value func(p *models.Product) string, limit int) []models.FacetCount {
+	counts := map[string]int64{}
+	for i := range products {
+		if v := value(&products[i]); v != "" {
+			counts[v]++
+		}
+	}
+
+	values := make([]models.FacetCount, 0, len(counts))
+	for v, count := range counts {
+		values = append(values, models.FacetCount{Value: v, Count: count})
+	}
+	slices.SortFunc(values, func(a, b models.FacetCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	return values
+}
+
+// applyFields copies the named fields from src to dst and reports whether any changed.
+func applyFields(dst, src *models.Product, fields []string) bool {
+	changed := false
+	for _, field := range fields {
+		switch field {
+		case "title":
+			changed = setField(&dst.Title, src.Title) || changed
+		case "asin":
+			changed = setField(&dst.ASIN, src.ASIN) || changed
+		case "description":
+			changed = setField(&dst.Description, src.Description) || changed
+		case "category":
+			changed = setField(&dst.Category, src.Category) || changed
+		case "brand":
+			changed = setField(&dst.Brand, src.Brand) || changed
+		case "image_url":
+			changed = setField(&dst.ImageURL, src.ImageURL) || changed
+		case "product_url":
+			changed = setField(&dst.ProductURL, src.ProductURL) || changed
+		case "price":
+			changed = setField(&dst.Price, src.Price) || changed
+		case "currency":
+			changed = setField(&dst.Currency, src.Currency) || changed
+		case "country":
+			changed = setField(&dst.Country, src.Country) || changed
+		case "stock":
+			changed = setField(&dst.Stock, src.Stock) || changed
+		case "avg_rating":
+			changed = setNullableField(&dst.AvgRating, src.AvgRating) || changed
+		case "review_count":
+			changed = setNullableField(&dst.ReviewCount, src.ReviewCount) || changed
+		case "bought_in_last_month":
+			changed = setNullableField(&dst.BoughtInLastMonth, src.BoughtInLastMonth) || changed
+		case "is_best_seller":
+			changed = setField(&dst.IsBestSeller, src.IsBestSeller) || changed
+		}
+	}
+	return changed
+}
+
+func setField[T comparable](dst *T, value T) bool {
+	if *dst == value {
+		return false
+	}
+	*dst = value
+	return true
+}
+
+func setNullableField[T comparable](dst **T, value *T) bool {
+	if (*dst == nil && value == nil) || (*dst != nil && value != nil && **dst == *value) {
+		return false
+	}
+	*dst = clonePointer(value)
+	return true
+}
+
+// cloneProduct copies the stored columns of p, so callers never share its pointers.
+func cloneProduct(p *models.Product) models.Product {
+	return models.Product{
+		ID:                p.ID,
+		Title:             p.Title,
+		ASIN:              p.ASIN,
+		Description:       p.Description,
+		Category:          p.Category,
+		Brand:             p.Brand,
+		ImageURL:          p.ImageURL,
+		ProductURL:        p.ProductURL,
+		Price:             p.Price,
+		Currency:          p.Currency,
+		Country:           p.Country,
+		Stock:             p.Stock,
+		AvgRating:         clonePointer(p.AvgRating),
+		ReviewCount:       clonePointer(p.ReviewCount),
+		BoughtInLastMonth: clonePointer(p.BoughtInLastMonth),
+		IsBestSeller:      p.IsBestSeller,
+		CreatedAt:         clonePointer(p.CreatedAt),
+		UpdatedAt:         clonePointer(p.UpdatedAt),
+	}
+}
+
+func clonePointer[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+// memoryNow truncates to microseconds, the precision of a Postgres timestamptz.
+func memoryNow() *time.Time {
+	now := time.Now().Truncate(time.Microsecond)
+	return &now
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"ecommerce_product_listing/models"
+	"html"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// The in-memory store approximates Postgres text search: enough to exercise the
+// search types offline, not to reproduce their exact matches or scores.
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// englishStopWords is a subset of the english text search dictionary's stop list.
+var englishStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "with": true,
+}
+
+// lexemes lowercases, drops stop words and strips common English suffixes, roughly
+// what to_tsvector('english', text) keeps.
+func lexemes(text string) []string {
+	words := wordPattern.FindAllString(strings.ToLower(text), -1)
+	out := make([]string, 0, len(words))
+	for _, word := range words {
+		if !englishStopWords[word] {
+			out = append(out, stem(word))
+		}
+	}
+	return out
+}
+
+func stem(word string) string {
+	for _, suffix := range []string{"ies", "ing", "ed", "es", "s"} {
+		if len(word) > len(suffix)+2 && strings.HasSuffix(word, suffix) {
+			if suffix == "ies" {
+				return strings.TrimSuffix(word, suffix) + "y"
+			}
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
+
+// webSearchQuery is a parsed websearch_to_tsquery: OR-separated groups of terms
+// that must all appear, plus "-term" exclusions. Quoted phrases match as plain terms.
+type webSearchQuery struct {
+	groups   [][]searchTerm
+	excluded []searchTerm
+}
+
+// searchTerm is a query lexeme and its synonyms. It matches a document containing
+// every lexeme of any one alternative.
+type searchTerm [][]string
+
+func parseWebSearch(text string, dictionary *searchDictionary) *webSearchQuery {
+	q := &webSearchQuery{groups: [][]searchTerm{{}}}
+	for _, token := range strings.Fields(strings.ReplaceAll(text, `"`, " ")) {
+		switch {
+		case strings.EqualFold(token, "or"):
+			q.groups = append(q.groups, []searchTerm{})
+		case strings.HasPrefix(token, "-"):
+			q.excluded = append(q.excluded, dictionary.terms(token[1:])...)
+		default:
+			last := len(q.groups) - 1
+			q.groups[last] = append(q.groups[last], dictionary.terms(token)...)
+		}
+	}
+	return q
+}
+
+// terms are every lexeme the query looks for, synonyms included, for ranking and
+// highlighting.
+func (q *webSearchQuery) terms() map[string]bool {
+	terms := map[string]bool{}
+	for _, group := range q.groups {
+		for _, term := range group {
+			for _, alternative := range term {
+				for _, lexeme := range alternative {
+					terms[lexeme] = true
+				}
+			}
+		}
+	}
+	return terms
+}
+
+// matches reports whether a document's lexemes satisfy the query. A query of only
+// stop words matches nothing, as in Postgres.
+func (q *webSearchQuery) matches(doc map[string]int) bool {
+	for _, term := range q.excluded {
+		if term.matches(doc) {
+			return false
+		}
+	}
+	for _, group := range q.groups {
+		if len(group) == 0 {
+			continue
+		}
+		all := true
+		for _, term := range group {
+			if !term.matches(doc) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+func (t searchTerm) matches(doc map[string]int) bool {
+	for _, alternative := range t {
+		found := true
+		for _, lexeme := range alternative {
+			if doc[lexeme] == 0 {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// searchDictionary is the compiled form of the synonym and stop-word tables. Unlike
+// search_tsquery it only expands single-word terms. A nil dictionary is empty.
+type searchDictionary struct {
+	synonyms  map[string][][]string // term lexeme -> lexemes of each synonym
+	stopWords map[string]bool
+}
+
+func newSearchDictionary(synonyms map[string]models.Synonym, stopWords map[string]models.StopWord) *searchDictionary {
+	d := &searchDictionary{synonyms: map[string][][]string{}, stopWords: map[string]bool{}}
+	for word := range stopWords {
+		d.stopWords[word] = true
+	}
+	for _, s := range synonyms {
+		term := lexemes(s.Term)
+		if len(term) != 1 {
+			continue
+		}
+		for _, synonym := range s.Synonyms {
+			if alternative := lexemes(synonym); len(alternative) > 0 {
+				d.synonyms[term[0]] = append(d.synonyms[term[0]], alternative)
+			}
+		}
+	}
+	return d
+}
+
+// terms turns one query token into search terms, dropping stop words.
+func (d *searchDictionary) terms(token string) []searchTerm {
+	words := wordPattern.FindAllString(strings.ToLower(token), -1)
+	kept := make([]string, 0, len(words))
+	for _, word := range words {
+		if d == nil || !d.stopWords[word] {
+			kept = append(kept, word)
+		}
+	}
+
+	var terms []searchTerm
+	for _, lexeme := range lexemes(strings.Join(kept, " ")) {
+		term := searchTerm{{lexeme}}
+		if d != nil {
+			term = append(term, d.synonyms[lexeme]...)
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// searchDocument mirrors search_vector: title lexemes weighted A, description B.
+type searchDocument struct {
+	title       map[string]int
+	description map[string]int
+	all         map[string]int
+	length      int
+}
+
+func newSearchDocument(title, description string) *searchDocument {
+	doc := &searchDocument{title: map[string]int{}, description: map[string]int{}, all: map[string]int{}}
+	for _, lexeme := range lexemes(title) {
+		doc.title[lexeme]++
+		doc.all[lexeme]++
+		doc.length++
+	}
+	for _, lexeme := range lexemes(description) {
+		doc.description[lexeme]++
+		doc.all[lexeme]++
+		doc.length++
+	}
+	return doc
+}
+
+// rank weighs query term hits with the default A and B weights (1.0 and 0.4) and
+// divides by 1 + log(document length), like normalization 1 of ts_rank.
+func (d *searchDocument) rank(terms map[string]bool) float64 {
+	score := 0.0
+	for term := range terms {
+		score += float64(d.title[term]) + 0.4*float64(d.description[term])
+	}
+	return score / (1 + math.Log(float64(d.length)+1))
+}
+
+// highlight HTML-escapes text and wraps words matching a query term in <mark>, as
+// ts_headline does over the escaped column.
+func highlight(text string, terms map[string]bool) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range wordPattern.FindAllStringIndex(text, -1) {
+		word := text[loc[0]:loc[1]]
+		out.WriteString(html.EscapeString(text[last:loc[0]]))
+		if terms[stem(strings.ToLower(word))] {
+			out.WriteString("<mark>" + word + "</mark>")
+		} else {
+			out.WriteString(word)
+		}
+		last = loc[1]
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+	return out.String()
+}
+
+// trigrams splits text into pg_trgm trigrams: each word lowercased and padded with
+// two spaces in front and one behind.
+func trigrams(words []string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// wordSimilarity approximates pg_trgm word_similarity(query, text): the best trigram
+// similarity between the query and any run of consecutive words in text.
+func wordSimilarity(query, text string) float64 {
+	queryWords := wordPattern.FindAllString(strings.ToLower(query), -1)
+	textWords := wordPattern.FindAllString(strings.ToLower(text), -1)
+	if len(queryWords) == 0 {
+		return 0
+	}
+	want := trigrams(queryWords)
+
+	best := 0.0
+	for start := range textWords {
+		for end := start + 1; end <= len(textWords) && end-start <= len(queryWords)+1; end++ {
+			have := trigrams(textWords[start:end])
+			shared := 0
+			for trigram := range want {
+				if have[trigram] {
+					shared++
+				}
+			}
+			similarity := float64(shared) / float64(len(want)+len(have)-shared)
+			if similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
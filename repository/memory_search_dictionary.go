@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/models"
+	"maps"
+	"slices"
+	"strings"
+)
+
+func (r *MemoryProductRepository) ListSynonyms(ctx context.Context) ([]models.Synonym, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	synonyms := slices.AppendSeq(make([]models.Synonym, 0, len(r.synonyms)), maps.Values(r.synonyms))
+	slices.SortFunc(synonyms, func(a, b models.Synonym) int {
+		return strings.Compare(a.Term, b.Term)
+	})
+	for i := range synonyms {
+		synonyms[i].Synonyms = slices.Clone(synonyms[i].Synonyms)
+	}
+	return synonyms, nil
+}
+
+func (r *MemoryProductRepository) PutSynonym(ctx context.Context, s *models.Synonym) (*models.Synonym, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.UpdatedAt = memoryNow()
+	r.synonyms[s.Term] = models.Synonym{Term: s.Term, Synonyms: slices.Clone(s.Synonyms), UpdatedAt: s.UpdatedAt}
+	r.dictionary = nil
+	return s, nil
+}
+
+func (r *MemoryProductRepository) DeleteSynonym(ctx context.Context, term string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.synonyms[term]; !ok {
+		return ErrSynonymNotFound
+	}
+	delete(r.synonyms, term)
+	r.dictionary = nil
+	return nil
+}
+
+func (r *MemoryProductRepository) ListStopWords(ctx context.Context) ([]models.StopWord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stopWords := slices.AppendSeq(make([]models.StopWord, 0, len(r.stopWords)), maps.Values(r.stopWords))
+	slices.SortFunc(stopWords, func(a, b models.StopWord) int {
+		return strings.Compare(a.Word, b.Word)
+	})
+	return stopWords, nil
+}
+
+func (r *MemoryProductRepository) AddStopWord(ctx context.Context, w *models.StopWord) (*models.StopWord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.stopWords[w.Word]; ok {
+		w.CreatedAt = existing.CreatedAt
+		return w, nil
+	}
+	w.CreatedAt = memoryNow()
+	r.stopWords[w.Word] = *w
+	r.dictionary = nil
+	return w, nil
+}
+
+func (r *MemoryProductRepository) DeleteStopWord(ctx context.Context, word string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.stopWords[word]; !ok {
+		return ErrStopWordNotFound
+	}
+	delete(r.stopWords, word)
+	r.dictionary = nil
+	return nil
+}
+
+// searchDictionary returns the compiled dictionaries, rebuilding them after an edit.
+func (r *MemoryProductRepository) searchDictionary() *searchDictionary {
+	r.mu.RLock()
+	dictionary := r.dictionary
+	r.mu.RUnlock()
+	if dictionary != nil {
+		return dictionary
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dictionary == nil {
+		r.dictionary = newSearchDictionary(r.synonyms, r.stopWords)
+	}
+	return r.dictionary
+}
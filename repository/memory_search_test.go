@@ -0,0 +1,13 @@
+package repository
+
+import "testing"
+
+func TestHighlightEscapesHTML(t *testing.T) {
+	terms := map[string]bool{stem("cable"): true, stem("amp"): true}
+
+	got := highlight(`USB-C <b>cable</b> & "fast" charger's amp`, terms)
+	want := `USB-C &lt;b&gt;<mark>cable</mark>&lt;/b&gt; &amp; &#34;fast&#34; charger&#39;s <mark>amp</mark>`
+	if got != want {
+		t.Errorf("highlight = %s, want %s", got, want)
+	}
+}
@@ -4,16 +4,73 @@ import (
 	"context"
 	"ecommerce_product_listing/config"
 	"ecommerce_product_listing/models"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type ProductRepository struct{}
 
+// ErrProductNotFound is returned by single-product lookups that match no row.
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrDuplicateASIN is returned when a write would give a product an ASIN another
+// product already has, violating products_asin_key.
+var ErrDuplicateASIN = errors.New("duplicate ASIN")
+
+// asinConflict maps a products_asin_key violation to ErrDuplicateASIN and returns
+// other errors unchanged.
+func asinConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "products_asin_key" {
+		return ErrDuplicateASIN
+	}
+	return err
+}
+
+// productColumns is the column list every product read selects, in productScanDest order.
+// Nullable text columns read back as ""; nullable numbers scan into pointers.
+const productColumns = `id, title, coalesce(asin, '') AS asin, coalesce(description, '') AS description, ` +
+	`coalesce(category, '') AS category, coalesce(brand, '') AS brand, coalesce(image_url, '') AS image_url, ` +
+	`coalesce(product_url, '') AS product_url, price, currency, coalesce(country, '') AS country, stock, ` +
+	`avg_rating, review_count, bought_in_last_month, coalesce(is_best_seller, false) AS is_best_seller, created_at, updated_at`
+
+// ts_headline options for search_engine highlighting
+const (
+	titleHeadlineOptions       = "StartSel=<mark>, StopSel=</mark>, HighlightAll=true"
+	descriptionHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10"
+)
+
+func productScanDest(p *models.Product) []interface{} {
+	return []interface{}{
+		&p.ID,
+		&p.Title,
+		&p.ASIN,
+		&p.Description,
+		&p.Category,
+		&p.Brand,
+		&p.ImageURL,
+		&p.ProductURL,
+		&p.Price,
+		&p.Currency,
+		&p.Country,
+		&p.Stock,
+		&p.AvgRating,
+		&p.ReviewCount,
+		&p.BoughtInLastMonth,
+		&p.IsBestSeller,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	}
+}
+
 func (r *ProductRepository) CreateProduct(
 	ctx context.Context,
 	p *models.Product,
@@ -29,7 +86,7 @@ func (r *ProductRepository) CreateProduct(
 		ctx,
 		query,
 		p.Title,
-		p.ASIN,
+		nullString(p.ASIN),
 		p.Description,
 		p.Category,
 		p.Brand,
@@ -46,7 +103,7 @@ func (r *ProductRepository) CreateProduct(
 	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
 
 	if err != nil {
-		return nil, err
+		return nil, asinConflict(err)
 	}
 
 	return p, nil
@@ -74,7 +131,7 @@ func (r *ProductRepository) CreateProductsBulk(
 	for _, p := range products {
 		batch.Queue(query,
 			p.Title,
-			p.ASIN,
+			nullString(p.ASIN),
 			p.Description,
 			p.Category,
 			p.Brand,
@@ -117,236 +174,533 @@ func (r *ProductRepository) CreateProductsBulk(
 	return products, nil
 }
 
+// GetProducts returns a page of products and whether more rows follow it in the
+// direction of travel (backward pages report rows before them).
 func (r *ProductRepository) GetProducts(
 	ctx context.Context,
 	productFilter *models.ProductFilter,
-) ([]models.Product, error) {
+) ([]models.Product, bool, error) {
 
 	productFilter.Normalize()
 
-	query := `SELECT 
-	id, title, asin, description, category, brand, image_url, product_url, price, currency, country, stock, avg_rating, review_count, bought_in_last_month, is_best_seller, created_at, updated_at
-	FROM products WHERE 1=1 `
+	query, err := newProductsQuery(productFilter)
+	if err != nil {
+		return nil, false, err
+	}
+	sql, args, err := buildSQL(query)
+	if err != nil {
+		return nil, false, err
+	}
 
-	args := []interface{}{}
-	argPos := 1
+	log.Printf("Constructed SQL query: %s", sql)
+	log.Printf("With arguments: %v", args)
 
-	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.SimpleTextSearchType {
-		query += fmt.Sprintf(" AND (title ILIKE $%d OR description ILIKE $%d)", argPos, argPos)
-		searchPattern := "%" + productFilter.SearchQueryText + "%"
-		args = append(args, searchPattern)
-		argPos++
-	}
+	products := []models.Product{}
 
-	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.VectorSearchType {
-		query += fmt.Sprintf(" AND search_vector @@ websearch_to_tsquery('english', $%d)", argPos)
-		args = append(args, productFilter.SearchQueryText)
-		argPos++
+	err = withSearchSettings(ctx, productFilter, func(q querier) error {
+		rows, err := q.Query(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var p models.Product
+			dest := productScanDest(&p)
+			if query.withRank {
+				dest = append(dest, &p.Rank, &p.TitleHighlight, &p.DescriptionHighlight)
+			}
+			if query.withRelevance {
+				dest = append(dest, &p.Relevance)
+			}
+			if query.withSimilarity {
+				dest = append(dest, &p.Similarity)
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			products = append(products, p)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, false, err
 	}
 
-	if productFilter.Category != "" {
-		query += fmt.Sprintf(" AND category = $%d", argPos)
-		args = append(args, productFilter.Category)
-		argPos++
+	hasMore := len(products) > productFilter.PageSize
+	if hasMore {
+		products = products[:productFilter.PageSize]
 	}
 
-	if productFilter.Brand != "" {
-		query += fmt.Sprintf(" AND brand = $%d", argPos)
-		args = append(args, productFilter.Brand)
-		argPos++
+	if query.backward {
+		slices.Reverse(products)
 	}
 
-	if productFilter.MinPrice != -1 {
-		query += fmt.Sprintf(" AND price >= $%d", argPos)
-		args = append(args, productFilter.MinPrice)
-		argPos++
-	}
+	return products, hasMore, nil
+}
 
-	if productFilter.MaxPrice != -1 {
-		query += fmt.Sprintf(" AND price <= $%d", argPos)
-		args = append(args, productFilter.MaxPrice)
-		argPos++
-	}
+// productsQuery is the page query GetProducts runs, with the columns it selects
+// beyond productColumns and whether its rows come back in reverse.
+type productsQuery struct {
+	*selectQuery
+	withRank       bool
+	withRelevance  bool
+	withSimilarity bool
+	backward       bool
+}
 
-	if !productFilter.ShowOutOfStock {
-		query += " AND stock > 0"
+// newProductsQuery builds the page query for a normalized filter.
+func newProductsQuery(productFilter *models.ProductFilter) (*productsQuery, error) {
+	query := &productsQuery{selectQuery: &selectQuery{
+		columns: []sqlExpr{sqlf(productColumns)},
+		from:    "products",
+		where:   filterExpr(productFilter, dimensionNone),
+	}}
+	var sortExpr sqlExpr = sqlf(string(productFilter.SortByColumn))
+
+	searchText := param(productFilter.SearchQueryText)
+
+	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.SearchEngineSearchType {
+		tsQuery := tsQueryExpression(searchText)
+		rank := rankExpression(tsQuery)
+		query.columns = append(query.columns,
+			rank,
+			headlineExpression("title", tsQuery, titleHeadlineOptions),
+			headlineExpression("coalesce(description, '')", tsQuery, descriptionHeadlineOptions),
+		)
+		query.withRank = true
+		if productFilter.SortByColumn == models.SortByRank {
+			sortExpr = rank
+		}
 	}
 
-	if productFilter.RatingMoreThanEqual > 0 {
-		query += fmt.Sprintf(" AND avg_rating >= $%d", argPos)
-		args = append(args, productFilter.RatingMoreThanEqual)
-		argPos++
+	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.FuzzySearchType {
+		sortExpr = similarityExpression(searchText)
+		query.columns = append(query.columns, sortExpr)
+		query.withSimilarity = true
 	}
 
-	if productFilter.ReviewCount > 0 {
-		query += fmt.Sprintf(" AND review_count >= $%d", argPos)
-		args = append(args, productFilter.ReviewCount)
-		argPos++
+	// Normalize only keeps the relevance sort for fts and search_engine searches
+	if productFilter.SortByColumn == models.SortByRelevance {
+		sortExpr = relevanceExpression(
+			tsQueryExpression(searchText),
+			param(productFilter.RelevancePopularityWeight),
+			param(productFilter.RelevanceRatingWeight),
+		)
+		query.columns = append(query.columns, sortExpr)
+		query.withRelevance = true
 	}
 
-	if productFilter.LastID != -1 && productFilter.SortLastValue != "" && productFilter.PageNumber == -1 {
-		operator := ">"
-		if productFilter.SortOrder == models.SortOrderDesc {
-			operator = "<"
+	// A backward page is read in reverse order from the cursor and flipped back by GetProducts
+	backward := productFilter.Backward && productFilter.PageNumber <= 0
+	query.backward = backward
+	nullable := productFilter.SortByColumn.Nullable()
+
+	if productFilter.LastID != -1 && productFilter.PageNumber == -1 {
+		keyset := keysetPosition{
+			sortExpr:   sortExpr,
+			nullable:   nullable,
+			descending: productFilter.SortOrder == models.SortOrderDesc,
+			backward:   backward,
 		}
 
-		var sortLastValue interface{}
-		var err error
-		switch productFilter.SortByColumn {
-		case models.SortByPrice, models.SortByRating:
-			sortLastValue, err = strconv.ParseFloat(productFilter.SortLastValue, 64)
-		case models.SortByPopularity:
-			sortLastValue, err = strconv.Atoi(productFilter.SortLastValue)
-		case models.SortByModificationDate:
-			sortLastValue, err = time.Parse(time.RFC3339Nano, productFilter.SortLastValue)
-		default:
-			err = fmt.Errorf("unsupported sort column: %s", productFilter.SortByColumn)
-		}
-		if err != nil {
-			return nil, fmt.Errorf("invalid cursor value for %s: %w", productFilter.SortByColumn, err)
+		if productFilter.SortLastValue == nil {
+			query.where.add(keyset.afterNull(productFilter.LastID))
+		} else {
+			var sortLastValue interface{}
+			var err error
+			switch productFilter.SortByColumn {
+			case models.SortByPrice, models.SortByRating, models.SortByRank, models.SortByRelevance, models.SortBySimilarity:
+				sortLastValue, err = strconv.ParseFloat(*productFilter.SortLastValue, 64)
+			case models.SortByPopularity:
+				sortLastValue, err = strconv.Atoi(*productFilter.SortLastValue)
+			case models.SortByModificationDate:
+				sortLastValue, err = time.Parse(time.RFC3339Nano, *productFilter.SortLastValue)
+			default:
+				err = fmt.Errorf("unsupported sort column: %s", productFilter.SortByColumn)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid cursor value for %s: %w", productFilter.SortByColumn, err)
+			}
+			query.where.add(keyset.afterValue(sortLastValue, productFilter.LastID))
 		}
-		query += fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", productFilter.SortByColumn, operator, argPos, argPos+1)
-		args = append(args, sortLastValue, productFilter.LastID)
-		argPos += 2
 	}
 
 	// Order By KeySet (SortByColumn, ID)
 	direction := "ASC"
-	if productFilter.SortOrder == models.SortOrderDesc {
+	if (productFilter.SortOrder == models.SortOrderDesc) != backward {
 		direction = "DESC"
 	}
-	if productFilter.PageNumber > 0 {
-		query += fmt.Sprintf(" ORDER BY %s %s", productFilter.SortByColumn, direction)
-	} else {
-		query += fmt.Sprintf(" ORDER BY %s %s, id %s", productFilter.SortByColumn, direction, direction)
+	// NULLs sort last on forward pages, so they come first when reading backward
+	nulls := ""
+	if nullable {
+		nulls = " NULLS LAST"
+		if backward {
+			nulls = " NULLS FIRST"
+		}
+	}
+	query.orderBy = []sqlExpr{sqlf("$1 "+direction+nulls, sortExpr)}
+	if productFilter.PageNumber <= 0 {
+		query.orderBy = append(query.orderBy, sqlf("id "+direction))
 	}
-	query += fmt.Sprintf(" LIMIT $%d", argPos)
-	args = append(args, productFilter.PageSize)
-	argPos++
+
+	// One extra row tells whether another page follows
+	query.limit = productFilter.PageSize + 1
 
 	if productFilter.PageNumber > 0 {
-		offset := (productFilter.PageNumber - 1) * productFilter.PageSize
-		if offset > 0 {
-			query += fmt.Sprintf(" OFFSET $%d", argPos)
-			args = append(args, offset)
-			argPos++
+		if offset := (productFilter.PageNumber - 1) * productFilter.PageSize; offset > 0 {
+			query.offset = offset
 		}
 	}
 
-	log.Printf("Constructed SQL query: %s", query)
-	log.Printf("With arguments: %v", args)
+	return query, nil
+}
 
-	rows, err := config.DB.Query(ctx, query, args...)
+func (r *ProductRepository) GetCounts(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+) (*models.Count, error) {
+	productFilter.Normalize()
 
+	sql, args, err := buildSQL(countQuery(productFilter))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	products := []models.Product{}
+	log.Printf("Constructed SQL count query: %s", sql)
+	log.Printf("With arguments: %v", args)
 
-	for rows.Next() {
-		var p models.Product
-		err := rows.Scan(
-			&p.ID,
-			&p.Title,
-			&p.ASIN,
-			&p.Description,
-			&p.Category,
-			&p.Brand,
-			&p.ImageURL,
-			&p.ProductURL,
-			&p.Price,
-			&p.Currency,
-			&p.Country,
-			&p.Stock,
-			&p.AvgRating,
-			&p.ReviewCount,
-			&p.BoughtInLastMonth,
-			&p.IsBestSeller,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		)
+	var count int64
+	var plan []byte
+	err = withSearchSettings(ctx, productFilter, func(q querier) error {
+		if productFilter.CountMode == models.EstimateCountMode {
+			return q.QueryRow(ctx, sql, args...).Scan(&plan)
+		}
+		return q.QueryRow(ctx, sql, args...).Scan(&count)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch productFilter.CountMode {
+	case models.EstimateCountMode:
+		count, err = planRows(plan)
 		if err != nil {
 			return nil, err
 		}
-		products = append(products, p)
+	case models.CappedCountMode:
+		if count > int64(productFilter.CountCap) {
+			return models.NewCount(int64(productFilter.CountCap), models.CappedCountMode, true), nil
+		}
 	}
 
-	return products, nil
+	return models.NewCount(count, productFilter.CountMode, false), nil
 }
 
-func (r *ProductRepository) GetCounts(
+// countQuery builds the statement GetCounts runs for the filter's count mode.
+func countQuery(productFilter *models.ProductFilter) sqlExpr {
+	counted := &selectQuery{
+		columns: []sqlExpr{sqlf("COUNT(*)")},
+		from:    "products",
+		where:   filterExpr(productFilter, dimensionNone),
+	}
+
+	var query sqlExpr = counted
+	switch productFilter.CountMode {
+	case models.EstimateCountMode:
+		// The planner's estimate for the filtered scan, from pg_class.reltuples and
+		// column statistics; nothing is read, so it can be off for skewed filters.
+		counted.columns = []sqlExpr{sqlf("1")}
+		query = sqlf("EXPLAIN (FORMAT JSON) $1", counted)
+	case models.CappedCountMode:
+		// Reading one row past the cap is enough to tell that there are more
+		counted.columns = []sqlExpr{sqlf("1")}
+		counted.limit = productFilter.CountCap + 1
+		query = sqlf("SELECT COUNT(*) FROM ($1) capped", counted)
+	}
+
+	return query
+}
+
+// planRows reads the top node's row estimate from EXPLAIN (FORMAT JSON) output.
+func planRows(plan []byte) (int64, error) {
+	var explained []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return 0, fmt.Errorf("decode query plan: %w", err)
+	}
+	if len(explained) == 0 {
+		return 0, errors.New("empty query plan")
+	}
+	return int64(explained[0].Plan.PlanRows), nil
+}
+
+func (r *ProductRepository) Suggest(
 	ctx context.Context,
-	productFilter *models.ProductFilter,
-) (int64, error) {
-	productFilter.Normalize()
+	prefix string,
+	limit int,
+) (*models.Suggestions, error) {
+
+	escaped := likeEscaper.Replace(prefix)
+	contains := "%" + escaped + "%"
+	startsWith := escaped + "%"
+
+	// Titles match anywhere so "galaxy" completes "Samsung Galaxy S24"; brands and
+	// categories match from the start. The trigram GIN indexes serve the ILIKE filters.
+	// Titles take only the best-selling matches, which the popularity index yields in
+	// order, before collapsing listings that share a title. Grouping every match would
+	// touch most of the table for a short, common prefix. Titles with no sales figure
+	// go last rather than first.
+	batch := &pgx.Batch{}
+	batch.Queue(`
+	SELECT title FROM (
+		SELECT id, title, bought_in_last_month FROM products
+		WHERE title ILIKE $1 AND stock > 0 AND deleted_at IS NULL
+		ORDER BY bought_in_last_month DESC NULLS LAST, id DESC
+		LIMIT $3
+	) candidates
+	GROUP BY title
+	ORDER BY MAX(bought_in_last_month) DESC NULLS LAST, MAX(id) DESC
+	LIMIT $2`, contains, limit, limit*models.SuggestCandidatesPerTitle)
+	batch.Queue(`
+	SELECT brand FROM products
+	WHERE brand ILIKE $1 AND stock > 0 AND deleted_at IS NULL
+	GROUP BY brand
+	ORDER BY COUNT(*) DESC
+	LIMIT $2`, startsWith, limit)
+	batch.Queue(`
+	SELECT category FROM products
+	WHERE category ILIKE $1 AND stock > 0 AND deleted_at IS NULL
+	GROUP BY category
+	ORDER BY COUNT(*) DESC
+	LIMIT $2`, startsWith, limit)
+
+	br := config.DB.SendBatch(ctx, batch)
+	defer br.Close()
+
+	suggestions := &models.Suggestions{}
+	for _, dest := range []*[]string{&suggestions.Titles, &suggestions.Brands, &suggestions.Categories} {
+		rows, err := br.Query()
+		if err != nil {
+			return nil, err
+		}
+		values, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+		*dest = values
+	}
 
-	query := `SELECT COUNT(*) FROM products WHERE 1=1 `
-	args := []interface{}{}
-	argPos := 1
+	return suggestions, nil
+}
 
-	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.SimpleTextSearchType {
-		query += fmt.Sprintf(" AND (title ILIKE $%d OR description ILIKE $%d)", argPos, argPos)
-		searchPattern := "%" + productFilter.SearchQueryText + "%"
-		args = append(args, searchPattern)
-		argPos++
+// GetVocabulary lists the distinct brands, categories and currencies of live products.
+func (r *ProductRepository) GetVocabulary(ctx context.Context) (*models.Vocabulary, error) {
+
+	batch := &pgx.Batch{}
+	for _, column := range []string{"brand", "category", "currency"} {
+		batch.Queue(`SELECT DISTINCT ` + column + ` FROM products
+	WHERE ` + column + ` <> '' AND deleted_at IS NULL`)
 	}
 
-	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.VectorSearchType {
-		query += fmt.Sprintf(" AND search_vector @@ websearch_to_tsquery('english', $%d)", argPos)
-		args = append(args, productFilter.SearchQueryText)
-		argPos++
+	br := config.DB.SendBatch(ctx, batch)
+	defer br.Close()
+
+	vocabulary := &models.Vocabulary{}
+	for _, dest := range []*[]string{&vocabulary.Brands, &vocabulary.Categories, &vocabulary.Currencies} {
+		rows, err := br.Query()
+		if err != nil {
+			return nil, err
+		}
+		values, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+		*dest = values
 	}
 
-	if productFilter.Category != "" {
-		query += fmt.Sprintf(" AND category = $%d", argPos)
-		args = append(args, productFilter.Category)
-		argPos++
+	return vocabulary, nil
+}
+
+func (r *ProductRepository) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	return r.getProduct(ctx, "id = $1", id)
+}
+
+func (r *ProductRepository) GetProductByASIN(ctx context.Context, asin string) (*models.Product, error) {
+	return r.getProduct(ctx, "asin = $1", asin)
+}
+
+func (r *ProductRepository) getProduct(
+	ctx context.Context,
+	condition string,
+	arg interface{},
+) (*models.Product, error) {
+
+	query := `SELECT ` + productColumns + ` FROM products WHERE deleted_at IS NULL AND ` + condition
+
+	var p models.Product
+	err := config.DB.QueryRow(ctx, query, arg).Scan(productScanDest(&p)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if productFilter.Brand != "" {
-		query += fmt.Sprintf(" AND brand = $%d", argPos)
-		args = append(args, productFilter.Brand)
-		argPos++
+	return &p, nil
+}
+
+func (r *ProductRepository) UpdateProduct(
+	ctx context.Context,
+	id int,
+	p *models.Product,
+) (*models.Product, error) {
+
+	query := `
+	UPDATE products SET
+		title = $2, asin = $3, description = $4, category = $5, brand = $6, image_url = $7, product_url = $8,
+		price = $9, currency = $10, country = $11, stock = $12, avg_rating = $13, review_count = $14,
+		bought_in_last_month = $15, is_best_seller = $16, updated_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL
+	RETURNING ` + productColumns
+
+	// Omitted nullable text fields are stored as NULL, as PatchProduct does, so a
+	// product without an ASIN doesn't collide with others on products_asin_key
+	var updated models.Product
+	err := config.DB.QueryRow(
+		ctx,
+		query,
+		id,
+		p.Title,
+		nullString(p.ASIN),
+		nullString(p.Description),
+		nullString(p.Category),
+		nullString(p.Brand),
+		nullString(p.ImageURL),
+		nullString(p.ProductURL),
+		p.Price,
+		p.Currency,
+		nullString(p.Country),
+		p.Stock,
+		p.AvgRating,
+		p.ReviewCount,
+		p.BoughtInLastMonth,
+		p.IsBestSeller,
+	).Scan(productScanDest(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, asinConflict(err)
 	}
 
-	if productFilter.MinPrice != -1 {
-		query += fmt.Sprintf(" AND price >= $%d", argPos)
-		args = append(args, productFilter.MinPrice)
-		argPos++
+	return &updated, nil
+}
+
+// PatchProduct updates only the given columns, taking their values from p.
+func (r *ProductRepository) PatchProduct(
+	ctx context.Context,
+	id int,
+	columns []string,
+	p *models.Product,
+) (*models.Product, error) {
+
+	// Nullable text columns read back as "", so "" is written as NULL
+	values := map[string]interface{}{
+		"title":                p.Title,
+		"asin":                 nullString(p.ASIN),
+		"description":          nullString(p.Description),
+		"category":             nullString(p.Category),
+		"brand":                nullString(p.Brand),
+		"image_url":            nullString(p.ImageURL),
+		"product_url":          nullString(p.ProductURL),
+		"price":                p.Price,
+		"currency":             p.Currency,
+		"country":              nullString(p.Country),
+		"stock":                p.Stock,
+		"avg_rating":           p.AvgRating,
+		"review_count":         p.ReviewCount,
+		"bought_in_last_month": p.BoughtInLastMonth,
+		"is_best_seller":       p.IsBestSeller,
 	}
 
-	if productFilter.MaxPrice != -1 {
-		query += fmt.Sprintf(" AND price <= $%d", argPos)
-		args = append(args, productFilter.MaxPrice)
+	query := `UPDATE products SET updated_at = NOW()`
+	args := []interface{}{id}
+	argPos := 2
+
+	for _, column := range columns {
+		value, ok := values[column]
+		if !ok {
+			return nil, fmt.Errorf("unsupported patch column: %s", column)
+		}
+		query += fmt.Sprintf(", %s = $%d", column, argPos)
+		args = append(args, value)
 		argPos++
 	}
 
-	if !productFilter.ShowOutOfStock {
-		query += " AND stock > 0"
+	query += ` WHERE id = $1 AND deleted_at IS NULL RETURNING ` + productColumns
+
+	log.Printf("Constructed SQL patch query: %s", query)
+
+	var updated models.Product
+	err := config.DB.QueryRow(ctx, query, args...).Scan(productScanDest(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, asinConflict(err)
 	}
 
-	if productFilter.RatingMoreThanEqual > 0 {
-		query += fmt.Sprintf(" AND avg_rating >= $%d", argPos)
-		args = append(args, productFilter.RatingMoreThanEqual)
-		argPos++
+	return &updated, nil
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
 	}
+	return &s
+}
 
-	if productFilter.ReviewCount > 0 {
-		query += fmt.Sprintf(" AND review_count >= $%d", argPos)
-		args = append(args, productFilter.ReviewCount)
-		argPos++
+// SoftDeleteProduct hides a product from every read until it is restored.
+func (r *ProductRepository) SoftDeleteProduct(ctx context.Context, id int) error {
+	tag, err := config.DB.Exec(ctx, `UPDATE products SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
 	}
+	return nil
+}
 
-	log.Printf("Constructed SQL count query: %s", query)
-	log.Printf("With arguments: %v", args)
+func (r *ProductRepository) RestoreProduct(ctx context.Context, id int) (*models.Product, error) {
+	query := `UPDATE products SET deleted_at = NULL, updated_at = NOW()
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING ` + productColumns
 
-	var count int64
-	err := config.DB.QueryRow(ctx, query, args...).Scan(&count)
+	var p models.Product
+	err := config.DB.QueryRow(ctx, query, id).Scan(productScanDest(&p)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return count, nil
+	return &p, nil
+}
+
+// PurgeProduct permanently removes a product, deleted or not.
+func (r *ProductRepository) PurgeProduct(ctx context.Context, id int) error {
+	tag, err := config.DB.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	return nil
 }
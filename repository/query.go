@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// filterDimension names a group of filter conditions that a facet can leave out,
+// so its counts show what selecting another value would return.
+type filterDimension string
+
+const (
+	dimensionNone       filterDimension = ""
+	dimensionCategory   filterDimension = "category"
+	dimensionBrand      filterDimension = "brand"
+	dimensionRating     filterDimension = "rating"
+	dimensionStock      filterDimension = "stock"
+	dimensionPrice      filterDimension = "price"
+	dimensionBestSeller filterDimension = "best_seller"
+)
+
+// filterExpr compiles the filter into AND-ed conditions, leaving out the ones that
+// belong to skip. Callers add their own conditions to the returned group.
+func filterExpr(productFilter *models.ProductFilter, skip filterDimension) *sqlGroup {
+
+	where := allOf(sqlf("deleted_at IS NULL"))
+
+	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.SimpleTextSearchType {
+		searchPattern := param("%" + productFilter.SearchQueryText + "%")
+		where.add(anyOf(sqlf("title ILIKE $1", searchPattern), sqlf("description ILIKE $1", searchPattern)))
+	}
+
+	if productFilter.SearchQueryText != "" &&
+		(productFilter.SearchType == models.VectorSearchType || productFilter.SearchType == models.SearchEngineSearchType) {
+		where.add(sqlf("search_vector @@ $1", tsQueryExpression(param(productFilter.SearchQueryText))))
+	}
+
+	if productFilter.SearchQueryText != "" && productFilter.SearchType == models.FuzzySearchType {
+		text := param(productFilter.SearchQueryText)
+		where.add(anyOf(sqlf("$1 <% title", text), sqlf("$1 <% description", text)))
+	}
+
+	if len(productFilter.Category) > 0 && skip != dimensionCategory {
+		where.add(sqlf("category = ANY($1)", productFilter.Category))
+	}
+
+	if len(productFilter.CategoryNot) > 0 && skip != dimensionCategory {
+		where.add(anyOf(sqlf("category IS NULL"), sqlf("category <> ALL($1)", productFilter.CategoryNot)))
+	}
+
+	if len(productFilter.Brand) > 0 && skip != dimensionBrand {
+		where.add(sqlf("brand = ANY($1)", productFilter.Brand))
+	}
+
+	if len(productFilter.BrandNot) > 0 && skip != dimensionBrand {
+		where.add(anyOf(sqlf("brand IS NULL"), sqlf("brand <> ALL($1)", productFilter.BrandNot)))
+	}
+
+	if productFilter.MinPrice != -1 && skip != dimensionPrice {
+		where.add(sqlf("price >= $1", productFilter.MinPrice))
+	}
+
+	if productFilter.MaxPrice != -1 && skip != dimensionPrice {
+		where.add(sqlf("price <= $1", productFilter.MaxPrice))
+	}
+
+	if !productFilter.ShowOutOfStock && skip != dimensionStock {
+		where.add(sqlf("stock > 0"))
+	}
+
+	if productFilter.RatingMoreThanEqual > 0 && skip != dimensionRating {
+		where.add(sqlf("avg_rating >= $1", productFilter.RatingMoreThanEqual))
+	}
+
+	if productFilter.ReviewCount > 0 {
+		where.add(sqlf("review_count >= $1", productFilter.ReviewCount))
+	}
+
+	// Literal predicates so the planner can match the is_best_seller partial indexes
+	if productFilter.IsBestSeller != nil && skip != dimensionBestSeller {
+		if *productFilter.IsBestSeller {
+			where.add(sqlf("is_best_seller"))
+		} else {
+			where.add(sqlf("is_best_seller IS NOT TRUE"))
+		}
+	}
+
+	if len(productFilter.Country) > 0 {
+		where.add(sqlf("country = ANY($1)", productFilter.Country))
+	}
+
+	if len(productFilter.Currency) > 0 {
+		where.add(sqlf("currency = ANY($1)", productFilter.Currency))
+	}
+
+	// Validate has already checked the timestamps; Postgres parses both accepted formats
+	for _, bound := range []struct {
+		condition string
+		value     string
+	}{
+		{"created_at >= $1::timestamptz", productFilter.CreatedAfter},
+		{"created_at < $1::timestamptz", productFilter.CreatedBefore},
+		{"updated_at >= $1::timestamptz", productFilter.UpdatedSince},
+		{"updated_at < $1::timestamptz", productFilter.UpdatedBefore},
+	} {
+		if bound.value != "" {
+			where.add(sqlf(bound.condition, bound.value))
+		}
+	}
+
+	if productFilter.Expression != nil {
+		where.add(expressionSQL(productFilter.Expression))
+	}
+
+	return where
+}
+
+// keysetPosition compiles the predicate for rows past a cursor row in the listing
+// order "sortExpr, id", where NULL sort values come after every non-NULL one.
+type keysetPosition struct {
+	sortExpr   sqlExpr
+	nullable   bool
+	descending bool
+	backward   bool
+}
+
+// operator compares toward the rows being fetched: onwards, or back toward the start.
+func (k keysetPosition) operator() string {
+	if k.descending != k.backward {
+		return "<"
+	}
+	return ">"
+}
+
+// afterValue matches rows past a cursor row with a non-NULL sort value.
+func (k keysetPosition) afterValue(value interface{}, id int) sqlExpr {
+	predicate := sqlf("($1, id) "+k.operator()+" ($2, $3)", k.sortExpr, value, id)
+	// The row comparison is NULL for NULL values; those rows follow every non-NULL one
+	if k.nullable && !k.backward {
+		return anyOf(predicate, sqlf("$1 IS NULL", k.sortExpr))
+	}
+	return predicate
+}
+
+// afterNull matches rows past a cursor row whose sort value is NULL.
+func (k keysetPosition) afterNull(id int) sqlExpr {
+	if k.backward {
+		return anyOf(sqlf("$1 IS NOT NULL", k.sortExpr), sqlf("id "+k.operator()+" $1", id))
+	}
+	return allOf(sqlf("$1 IS NULL", k.sortExpr), sqlf("id "+k.operator()+" $1", id))
+}
+
+// likeEscaper escapes the LIKE wildcards so user input matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// querier is satisfied by both the pool and a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// withSearchSettings runs fn against a connection set up for the filter's search type.
+// Fuzzy searches run inside a transaction so the trigram threshold used by the
+// index-backed <% operator can be set locally without leaking into the pool.
+func withSearchSettings(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+	fn func(q querier) error,
+) error {
+	if productFilter.SearchType != models.FuzzySearchType || productFilter.SearchQueryText == "" {
+		return fn(config.DB)
+	}
+
+	tx, err := config.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := applySearchSettings(ctx, tx, productFilter); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// applySearchSettings sets transaction-local settings the filter's search type relies on.
+func applySearchSettings(ctx context.Context, tx pgx.Tx, productFilter *models.ProductFilter) error {
+	if productFilter.SearchType != models.FuzzySearchType || productFilter.SearchQueryText == "" {
+		return nil
+	}
+
+	threshold := strconv.FormatFloat(productFilter.FuzzyThreshold, 'f', -1, 64)
+	_, err := tx.Exec(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", threshold)
+	return err
+}
+
+// tsQueryExpression parses the search text bound by text into a tsquery, applying
+// the synonym and stop-word dictionaries. The subquery runs once per statement rather
+// than once per row, and its result can still drive the search_vector index.
+func tsQueryExpression(text *sqlParam) sqlExpr {
+	return sqlf("(SELECT search_tsquery($1))", text)
+}
+
+// rankExpression scores search_vector against tsQuery. Normalization 1 divides by
+// 1 + log(document length) so long descriptions don't drown out title matches.
+// The float8 cast keeps the value exact when it round-trips through a keyset cursor.
+func rankExpression(tsQuery sqlExpr) sqlExpr {
+	return sqlf("ts_rank_cd(search_vector, $1, 1)::float8", tsQuery)
+}
+
+// headlineExpression highlights the tsQuery matches in column. The column is
+// HTML-escaped first, as html.EscapeString would, so the only markup in the result
+// is the <mark> ts_headline adds and clients can render it as HTML.
+func headlineExpression(column string, tsQuery sqlExpr, options string) sqlExpr {
+	escaped := column
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"''", "&#39;"}} {
+		escaped = "replace(" + escaped + ", '" + r[0] + "', '" + r[1] + "')"
+	}
+	return sqlf("ts_headline('english', "+escaped+", $1, '"+options+"')", tsQuery)
+}
+
+// similarityExpression scores the fuzzy search term against the closest word run in
+// the title or description.
+func similarityExpression(text *sqlParam) sqlExpr {
+	return sqlf("greatest(word_similarity($1, title), word_similarity($1, coalesce(description, '')))::float8", text)
+}
+
+// relevanceExpression blends the text rank with popularity and rating. Both weights
+// at 0 leave the plain text rank.
+func relevanceExpression(tsQuery sqlExpr, popularityWeight, ratingWeight *sqlParam) sqlExpr {
+	return sqlf(
+		"(ts_rank(search_vector, $1, 1) * (1 + $2::float8 * ln(1 + coalesce(bought_in_last_month, 0)) + $3::float8 * coalesce(avg_rating, 0) / 5))::float8",
+		tsQuery, popularityWeight, ratingWeight,
+	)
+}
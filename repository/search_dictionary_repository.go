@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrSynonymNotFound  = errors.New("synonym not found")
+	ErrStopWordNotFound = errors.New("stop word not found")
+)
+
+func (r *ProductRepository) ListSynonyms(ctx context.Context) ([]models.Synonym, error) {
+	rows, err := config.DB.Query(ctx, `SELECT term, synonyms, updated_at FROM search_synonyms ORDER BY term`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Synonym, error) {
+		var s models.Synonym
+		err := row.Scan(&s.Term, &s.Synonyms, &s.UpdatedAt)
+		return s, err
+	})
+}
+
+// PutSynonym creates the term's entry or replaces its synonyms.
+func (r *ProductRepository) PutSynonym(ctx context.Context, s *models.Synonym) (*models.Synonym, error) {
+	err := config.DB.QueryRow(ctx, `
+	INSERT INTO search_synonyms (term, synonyms) VALUES ($1, $2)
+	ON CONFLICT (term) DO UPDATE SET synonyms = EXCLUDED.synonyms, updated_at = CURRENT_TIMESTAMP
+	RETURNING updated_at`, s.Term, s.Synonyms).Scan(&s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *ProductRepository) DeleteSynonym(ctx context.Context, term string) error {
+	tag, err := config.DB.Exec(ctx, `DELETE FROM search_synonyms WHERE term = $1`, term)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSynonymNotFound
+	}
+	return nil
+}
+
+func (r *ProductRepository) ListStopWords(ctx context.Context) ([]models.StopWord, error) {
+	rows, err := config.DB.Query(ctx, `SELECT word, created_at FROM search_stop_words ORDER BY word`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.StopWord, error) {
+		var w models.StopWord
+		err := row.Scan(&w.Word, &w.CreatedAt)
+		return w, err
+	})
+}
+
+// AddStopWord adds a stop word; adding one that exists returns the existing entry.
+func (r *ProductRepository) AddStopWord(ctx context.Context, w *models.StopWord) (*models.StopWord, error) {
+	// The no-op update makes RETURNING yield the existing row on conflict
+	err := config.DB.QueryRow(ctx, `
+	INSERT INTO search_stop_words (word) VALUES ($1)
+	ON CONFLICT (word) DO UPDATE SET word = EXCLUDED.word
+	RETURNING created_at`, w.Word).Scan(&w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (r *ProductRepository) DeleteStopWord(ctx context.Context, word string) error {
+	tag, err := config.DB.Exec(ctx, `DELETE FROM search_stop_words WHERE word = $1`, word)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStopWordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sqlExpr is a piece of SQL that binds its own arguments while it is rendered, so
+// fragments compose into one statement without hand-numbered placeholders.
+type sqlExpr interface {
+	render(b *sqlBuilder) string
+}
+
+// buildSQL renders a complete statement and the arguments its placeholders refer to.
+// It fails if a fragment references a placeholder it has no argument for.
+func buildSQL(e sqlExpr) (string, []interface{}, error) {
+	b := &sqlBuilder{params: map[*sqlParam]string{}}
+	sql := e.render(b)
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	return sql, b.args, nil
+}
+
+// sqlBuilder numbers the placeholders of one statement and collects their arguments.
+// The first rendering error is kept in err; rendering carries on so callers need
+// not check after every fragment.
+type sqlBuilder struct {
+	args   []interface{}
+	params map[*sqlParam]string
+	err    error
+}
+
+// sqlParam is an argument used by several fragments. It is bound once per statement
+// and every use shares its placeholder.
+type sqlParam struct {
+	value interface{}
+}
+
+func param(value interface{}) *sqlParam {
+	return &sqlParam{value: value}
+}
+
+// bind renders an argument: expressions are inlined, anything else becomes a placeholder.
+func (b *sqlBuilder) bind(value interface{}) string {
+	switch v := value.(type) {
+	case sqlExpr:
+		return v.render(b)
+	case *sqlParam:
+		if placeholder, ok := b.params[v]; ok {
+			return placeholder
+		}
+		placeholder := b.bind(v.value)
+		b.params[v] = placeholder
+		return placeholder
+	}
+
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// sqlFragment is SQL text whose $1, $2, ... refer to its own args rather than the
+// statement's. Each arg is rendered once, however often it is referenced.
+type sqlFragment struct {
+	sql  string
+	args []interface{}
+}
+
+func sqlf(sql string, args ...interface{}) sqlFragment {
+	return sqlFragment{sql: sql, args: args}
+}
+
+var fragmentPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+func (f sqlFragment) render(b *sqlBuilder) string {
+	rendered := make([]string, len(f.args))
+	for i, arg := range f.args {
+		rendered[i] = b.bind(arg)
+	}
+	return fragmentPlaceholder.ReplaceAllStringFunc(f.sql, func(placeholder string) string {
+		n, err := strconv.Atoi(placeholder[1:])
+		if err != nil || n < 1 || n > len(rendered) {
+			if b.err == nil {
+				b.err = fmt.Errorf("sql fragment %q: placeholder %s has no argument (%d given)", f.sql, placeholder, len(rendered))
+			}
+			return placeholder
+		}
+		return rendered[n-1]
+	})
+}
+
+// sqlGroup joins conditions with AND or OR. Conditions that render empty are
+// dropped, and a group of one renders as that condition alone.
+type sqlGroup struct {
+	op    string
+	exprs []sqlExpr
+}
+
+func allOf(exprs ...sqlExpr) *sqlGroup {
+	return &sqlGroup{op: "AND", exprs: exprs}
+}
+
+func anyOf(exprs ...sqlExpr) *sqlGroup {
+	return &sqlGroup{op: "OR", exprs: exprs}
+}
+
+func (g *sqlGroup) add(exprs ...sqlExpr) {
+	g.exprs = append(g.exprs, exprs...)
+}
+
+func (g *sqlGroup) render(b *sqlBuilder) string {
+	parts := g.renderParts(b)
+	if len(parts) > 1 {
+		return "(" + strings.Join(parts, " "+g.op+" ") + ")"
+	}
+	return strings.Join(parts, "")
+}
+
+func (g *sqlGroup) renderParts(b *sqlBuilder) []string {
+	parts := make([]string, 0, len(g.exprs))
+	for _, e := range g.exprs {
+		if part := e.render(b); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// selectQuery assembles a SELECT. Limit and offset are bound as arguments when set.
+type selectQuery struct {
+	columns []sqlExpr
+	from    string
+	where   *sqlGroup
+	groupBy string
+	orderBy []sqlExpr
+	limit   interface{}
+	offset  interface{}
+}
+
+func (q *selectQuery) render(b *sqlBuilder) string {
+	sql := "SELECT " + renderList(b, q.columns) + " FROM " + q.from
+
+	if q.where != nil {
+		// The top-level group needs no parentheses
+		if parts := q.where.renderParts(b); len(parts) > 0 {
+			sql += " WHERE " + strings.Join(parts, " "+q.where.op+" ")
+		}
+	}
+	if q.groupBy != "" {
+		sql += " GROUP BY " + q.groupBy
+	}
+	if len(q.orderBy) > 0 {
+		sql += " ORDER BY " + renderList(b, q.orderBy)
+	}
+	if q.limit != nil {
+		sql += " LIMIT " + b.bind(q.limit)
+	}
+	if q.offset != nil {
+		sql += " OFFSET " + b.bind(q.offset)
+	}
+
+	return sql
+}
+
+func renderList(b *sqlBuilder, exprs []sqlExpr) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = e.render(b)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"ecommerce_product_listing/models"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden with the rendered SQL")
+
+// checkGolden renders the statements and compares them, with their arguments, to
+// testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, queries ...sqlExpr) {
+	t.Helper()
+
+	var out strings.Builder
+	for i, query := range queries {
+		sql, args, err := buildSQL(query)
+		if err != nil {
+			t.Fatalf("buildSQL: %v", err)
+		}
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(sql + "\n")
+		for n, arg := range args {
+			fmt.Fprintf(&out, "-- $%d = %T %v\n", n+1, arg, arg)
+		}
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(out.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test ./repository -update to create it)", err)
+	}
+	if got := out.String(); got != string(want) {
+		t.Errorf("%s mismatch\n--- got\n%s--- want\n%s", path, got, want)
+	}
+}
+
+func filterWith(edit func(f *models.ProductFilter)) *models.ProductFilter {
+	f := models.NewProductFilter()
+	edit(f)
+	f.Normalize()
+	return f
+}
+
+func TestProductsQuery(t *testing.T) {
+	price := "19.99"
+	rating := "4.5"
+
+	tests := []struct {
+		name   string
+		filter *models.ProductFilter
+	}{
+		{"products_first_page", filterWith(func(f *models.ProductFilter) {
+			f.Brand = []string{"Apple,Samsung"}
+			f.MinPrice = 10
+		})},
+		{"products_keyset_forward", filterWith(func(f *models.ProductFilter) {
+			f.SortByColumn = models.SortByPrice
+			f.SortOrder = models.SortOrderAsc
+			f.SortLastValue = &price
+			f.LastID = 42
+		})},
+		{"products_keyset_backward", filterWith(func(f *models.ProductFilter) {
+			f.SortByColumn = models.SortByRating
+			f.SortLastValue = &rating
+			f.LastID = 42
+			f.Backward = true
+		})},
+		{"products_keyset_null_cursor", filterWith(func(f *models.ProductFilter) {
+			f.SortByColumn = models.SortByRating
+			f.LastID = 42
+		})},
+		{"products_keyset_null_cursor_backward", filterWith(func(f *models.ProductFilter) {
+			f.SortByColumn = models.SortByRating
+			f.LastID = 42
+			f.Backward = true
+		})},
+		{"products_page_number", filterWith(func(f *models.ProductFilter) {
+			f.PageNumber = 3
+		})},
+		{"products_search_engine_relevance", filterWith(func(f *models.ProductFilter) {
+			f.SearchQueryText = "wireless headphones"
+			f.SearchType = models.SearchEngineSearchType
+			f.SortByColumn = models.SortByRelevance
+			f.RelevancePopularityWeight = 0.3
+		})},
+		{"products_fuzzy", filterWith(func(f *models.ProductFilter) {
+			f.SearchQueryText = "hedphones"
+			f.SearchType = models.FuzzySearchType
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := newProductsQuery(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query.backward != tt.filter.Backward {
+				t.Errorf("backward = %v, want %v", query.backward, tt.filter.Backward)
+			}
+			checkGolden(t, tt.name, query)
+		})
+	}
+}
+
+func TestProductsQueryInvalidCursor(t *testing.T) {
+	value := "not-a-price"
+	f := filterWith(func(f *models.ProductFilter) {
+		f.SortByColumn = models.SortByPrice
+		f.SortLastValue = &value
+		f.LastID = 42
+	})
+
+	if _, err := newProductsQuery(f); err == nil {
+		t.Fatal("expected an error for a non-numeric price cursor")
+	}
+}
+
+func TestCountQuery(t *testing.T) {
+	for _, mode := range []models.CountModeEnum{models.ExactCountMode, models.EstimateCountMode, models.CappedCountMode} {
+		t.Run(string(mode), func(t *testing.T) {
+			f := filterWith(func(f *models.ProductFilter) {
+				f.Category = []string{"Electronics"}
+				f.CountMode = mode
+				f.CountCap = 500
+			})
+			checkGolden(t, "count_"+string(mode), countQuery(f))
+		})
+	}
+}
+
+func TestFacetQueries(t *testing.T) {
+	// Every dimension is filtered, so each facet query shows which one it leaves out
+	bestSeller := true
+	f := filterWith(func(f *models.ProductFilter) {
+		f.Category = []string{"Electronics"}
+		f.Brand = []string{"Apple"}
+		f.MinPrice = 10
+		f.MaxPrice = 500
+		f.RatingMoreThanEqual = 4
+		f.IsBestSeller = &bestSeller
+	})
+
+	checkGolden(t, "facets", facetQueries(f)...)
+}
+
+func TestExportQuery(t *testing.T) {
+	f := filterWith(func(f *models.ProductFilter) {
+		f.SearchQueryText = "usb-c cable"
+		f.SearchType = models.VectorSearchType
+		f.ShowOutOfStock = true
+	})
+
+	checkGolden(t, "export", exportQuery(f))
+}
+
+func TestNestedGroups(t *testing.T) {
+	shared := param("shared")
+	query := &selectQuery{
+		columns: []sqlExpr{sqlf("id")},
+		from:    "products",
+		where: allOf(
+			sqlf("a = $1", 1),
+			anyOf(
+				sqlf("b = $1", shared),
+				allOf(sqlf("c = $1", shared), sqlf("(d = $1 OR e = $1)", 2)),
+				anyOf(), // empty groups are dropped
+				allOf(sqlf("f = $1", 3)),
+			),
+			allOf(anyOf(sqlf("")), sqlf("g IS NULL")),
+		),
+		limit: 10,
+	}
+
+	checkGolden(t, "nested_groups", query)
+}
+
+func TestExpressionGroups(t *testing.T) {
+	var filter models.FilterExpression
+	err := json.Unmarshal([]byte(`{"and": [
+		{"or": [
+			{"eq": {"field": "brand", "value": "Apple"}},
+			{"and": [
+				{"in": {"field": "category", "values": ["Phones", "Tablets"]}},
+				{"range": {"field": "price", "gte": 100, "lt": 500}}
+			]}
+		]},
+		{"not": {"or": [{"exists": {"field": "description"}}, {"eq": {"field": "is_best_seller", "value": true}}]}},
+		{"match": {"query": "wireless"}}
+	]}`), &filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := filterWith(func(f *models.ProductFilter) {
+		f.Expression = &filter
+	})
+	checkGolden(t, "expression_groups", countQuery(f))
+}
+
+func TestFragmentPlaceholderOutOfRange(t *testing.T) {
+	for _, query := range []sqlExpr{
+		sqlf("a = $1 AND b = $2", 1),
+		sqlf("a = $1"),
+		allOf(sqlf("ok = $1", 1), sqlf("bad = $0", 2)),
+	} {
+		if _, _, err := buildSQL(query); err == nil {
+			t.Errorf("expected an error for %#v", query)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/models"
+)
+
+// ProductStore is the product persistence the service layer depends on.
+// ProductRepository implements it over Postgres, MemoryProductRepository in memory.
+type ProductStore interface {
+	CreateProduct(ctx context.Context, p *models.Product) (*models.Product, error)
+	CreateProductsBulk(ctx context.Context, products []models.Product) ([]models.Product, error)
+	CreateProductsPartial(ctx context.Context, products []models.Product, opts *models.UpsertOptions) ([]models.BulkItemResult, error)
+	UpsertProduct(ctx context.Context, p *models.Product, opts *models.UpsertOptions) (*models.ProductWriteResult, error)
+	UpsertProductsBulk(ctx context.Context, products []models.Product, opts *models.UpsertOptions) ([]models.ProductWriteResult, error)
+	ImportProducts(ctx context.Context, src models.ProductSource, opts *models.UpsertOptions) (*models.ImportResult, error)
+
+	GetProducts(ctx context.Context, productFilter *models.ProductFilter) ([]models.Product, bool, error)
+	GetCounts(ctx context.Context, productFilter *models.ProductFilter) (*models.Count, error)
+	GetFacets(ctx context.Context, productFilter *models.ProductFilter) (*models.Facets, error)
+	Suggest(ctx context.Context, prefix string, limit int) (*models.Suggestions, error)
+	GetVocabulary(ctx context.Context) (*models.Vocabulary, error)
+	ExportProducts(ctx context.Context, productFilter *models.ProductFilter, fn func(p *models.Product) error) error
+
+	GetProductByID(ctx context.Context, id int) (*models.Product, error)
+	GetProductByASIN(ctx context.Context, asin string) (*models.Product, error)
+	UpdateProduct(ctx context.Context, id int, p *models.Product) (*models.Product, error)
+	PatchProduct(ctx context.Context, id int, columns []string, p *models.Product) (*models.Product, error)
+	SoftDeleteProduct(ctx context.Context, id int) error
+	RestoreProduct(ctx context.Context, id int) (*models.Product, error)
+	PurgeProduct(ctx context.Context, id int) error
+
+	ListSynonyms(ctx context.Context) ([]models.Synonym, error)
+	PutSynonym(ctx context.Context, s *models.Synonym) (*models.Synonym, error)
+	DeleteSynonym(ctx context.Context, term string) error
+	ListStopWords(ctx context.Context) ([]models.StopWord, error)
+	AddStopWord(ctx context.Context, w *models.StopWord) (*models.StopWord, error)
+	DeleteStopWord(ctx context.Context, word string) error
+}
+
+var (
+	_ ProductStore = (*ProductRepository)(nil)
+	_ ProductStore = (*MemoryProductRepository)(nil)
+)
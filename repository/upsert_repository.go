@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"ecommerce_product_listing/config"
+	"ecommerce_product_listing/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// upsertQuery inserts a product or, when its ASIN exists, overwrites only the given
+// fields. Rows whose overwritten fields already match are left alone and read back
+// as "unchanged", so updated_at only moves on real changes. A soft-deleted row is
+// restored and reads back as "updated".
+func upsertQuery(fields []string) string {
+	return fmt.Sprintf(`
+	WITH upserted AS (
+		INSERT INTO products (title, asin, description, category, brand, image_url, product_url, price, currency, country, stock, avg_rating, review_count, bought_in_last_month, is_best_seller, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW(), NOW())
+		%s
+		RETURNING %s, (xmax = 0) AS inserted
+	)
+	SELECT %s, CASE WHEN inserted THEN 'created' ELSE 'updated' END FROM upserted
+	UNION ALL
+	SELECT %s, 'unchanged' FROM products WHERE asin = $2 AND deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM upserted)`,
+		onConflictUpdate(fields),
+		productColumns,
+		productColumns,
+		productColumns,
+	)
+}
+
+// onConflictUpdate overwrites fields on an ASIN conflict, skipping the write when
+// they already hold the incoming values. The ASIN is unique across deleted rows too,
+// so a conflict with a deleted row also brings it back.
+func onConflictUpdate(fields []string) string {
+	fields = append([]string(nil), fields...)
+	sort.Strings(fields)
+
+	sets := make([]string, len(fields))
+	stored := make([]string, len(fields))
+	incoming := make([]string, len(fields))
+	for i, field := range fields {
+		sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", field, field)
+		stored[i] = "products." + field
+		incoming[i] = "EXCLUDED." + field
+	}
+
+	return fmt.Sprintf(
+		"ON CONFLICT (asin) DO UPDATE SET %s, deleted_at = NULL, updated_at = NOW() "+
+			"WHERE (%s) IS DISTINCT FROM (%s) OR products.deleted_at IS NOT NULL",
+		strings.Join(sets, ", "),
+		strings.Join(stored, ", "),
+		strings.Join(incoming, ", "),
+	)
+}
+
+// productInsertArgs lists p's columns in insert order. A blank ASIN goes in as NULL
+// so rows without one don't collide on products_asin_key.
+func productInsertArgs(p *models.Product) []interface{} {
+	return []interface{}{
+		p.Title,
+		nullString(p.ASIN),
+		p.Description,
+		p.Category,
+		p.Brand,
+		p.ImageURL,
+		p.ProductURL,
+		p.Price,
+		p.Currency,
+		p.Country,
+		p.Stock,
+		p.AvgRating,
+		p.ReviewCount,
+		p.BoughtInLastMonth,
+		p.IsBestSeller,
+	}
+}
+
+func scanWriteResult(row pgx.Row) (*models.ProductWriteResult, error) {
+	var p models.Product
+	var status string
+	if err := row.Scan(append(productScanDest(&p), &status)...); err != nil {
+		return nil, err
+	}
+	return &models.ProductWriteResult{Status: models.WriteStatus(status), Product: &p}, nil
+}
+
+func (r *ProductRepository) UpsertProduct(
+	ctx context.Context,
+	p *models.Product,
+	opts *models.UpsertOptions,
+) (*models.ProductWriteResult, error) {
+
+	query := upsertQuery(opts.Fields)
+	log.Printf("Upserting ASIN %s overwriting %s", p.ASIN, opts)
+
+	return scanWriteResult(config.DB.QueryRow(ctx, query, productInsertArgs(p)...))
+}
+
+func (r *ProductRepository) UpsertProductsBulk(
+	ctx context.Context,
+	products []models.Product,
+	opts *models.UpsertOptions,
+) ([]models.ProductWriteResult, error) {
+
+	tx, err := config.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := upsertQuery(opts.Fields)
+	log.Printf("Upserting %d products overwriting %s", len(products), opts)
+
+	batch := &pgx.Batch{}
+	for i := range products {
+		batch.Queue(query, productInsertArgs(&products[i])...)
+	}
+
+	br := tx.SendBatch(ctx, batch)
+
+	results := make([]models.ProductWriteResult, 0, len(products))
+	for range products {
+		result, err := scanWriteResult(br.QueryRow())
+		if err != nil {
+			br.Close()
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+
+	if err := br.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
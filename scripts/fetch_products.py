@@ -232,10 +232,9 @@ if __name__ == "__main__":
         start = time.time()
         page_no = 1
 
-        last_id = -1
+        cursor = None
         sort_by_column = query_params.get("sort_by_column", "")
         sort_order = query_params.get("sort_order", "asc")
-        sort_last_value = None
         page_no = 1
         page_size = query_params.get("page_size", 50)
         count = 1
@@ -268,15 +267,8 @@ if __name__ == "__main__":
                         "page_number": page_no,
                     }
                 )
-            else:
-                query_next.update(
-                    {
-                        "last_id": last_id,
-                        "sort_by_column": sort_by_column,
-                        "sort_order": sort_order,
-                        "sort_last_value": sort_last_value,
-                    }
-                )
+            elif cursor:
+                query_next["cursor"] = cursor
             start = time.time()
             # print(query_next)
             response = requests.get(FETCH_API, params=query_next)
@@ -301,11 +293,10 @@ if __name__ == "__main__":
             product_ids = [p["id"] for p in products]
             # print(f"Fetched {len(product_ids)} products: {product_ids}")
 
-            last_id = response.get("last_id", None)
-            sort_by_column = response.get("sort_by_column", "")
-            sort_order = response.get("sort_order", "asc")
-            sort_last_value = response.get("sort_last_value", None)
+            cursor = response.get("next_cursor", "")
             count = response.get("count", 0)
+            if not limit_offset_pagination and not cursor:
+                break
 
     with open(PATH, "w") as f:
         json.dump(response_times, f, indent=4)
@@ -2,14 +2,33 @@ package service
 
 import (
 	"context"
+	"ecommerce_product_listing/interpret"
 	"ecommerce_product_listing/models"
 	"ecommerce_product_listing/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 type ProductService struct {
-	Repo *repository.ProductRepository
+	Repo repository.ProductStore
+
+	lexiconMu     sync.Mutex
+	lexicon       *interpret.Lexicon
+	lexiconLoaded time.Time
+	lexiconLoad   singleflight.Group
 }
 
+// lexiconTTL is how long new brands and categories can go unrecognised in queries.
+const lexiconTTL = 5 * time.Minute
+
 func (s *ProductService) AddProduct(
 	ctx context.Context,
 	p *models.Product,
@@ -29,11 +48,266 @@ func (s *ProductService) AddProductsBulk(
 func (s *ProductService) ListProducts(
 	ctx context.Context,
 	prodcutFilter *models.ProductFilter,
-) ([]models.Product, error) {
+) ([]models.Product, bool, error) {
 
 	return s.Repo.GetProducts(ctx, prodcutFilter)
 }
 
-func (s *ProductService) GetCounts(ctx context.Context, productFilter *models.ProductFilter) (int64, error) {
+// InterpretQuery moves the price, rating, brand and category constraints in the
+// filter's search text into its filter fields when the caller asked for it.
+func (s *ProductService) InterpretQuery(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+) (*models.QueryInterpretation, error) {
+
+	if !productFilter.Interpret || strings.TrimSpace(productFilter.SearchQueryText) == "" {
+		return nil, nil
+	}
+
+	lexicon, err := s.getLexicon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return lexicon.Apply(productFilter), nil
+}
+
+// getLexicon returns the cached lexicon, reloading the catalog vocabulary once it is
+// older than lexiconTTL. A failed reload keeps serving the previous lexicon.
+func (s *ProductService) getLexicon(ctx context.Context) (*interpret.Lexicon, error) {
+	s.lexiconMu.Lock()
+	lexicon, loaded := s.lexicon, s.lexiconLoaded
+	s.lexiconMu.Unlock()
+
+	if lexicon != nil && time.Since(loaded) < lexiconTTL {
+		return lexicon, nil
+	}
+
+	// Concurrent callers share one vocabulary query; the lock is not held during it
+	reloaded, err, _ := s.lexiconLoad.Do("lexicon", func() (interface{}, error) {
+		vocabulary, err := s.Repo.GetVocabulary(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fresh := interpret.NewLexicon(vocabulary)
+		s.lexiconMu.Lock()
+		s.lexicon, s.lexiconLoaded = fresh, time.Now()
+		s.lexiconMu.Unlock()
+		return fresh, nil
+	})
+	if err != nil {
+		if lexicon != nil {
+			log.Println("Failed to reload query vocabulary, keeping the previous one:", err)
+			return lexicon, nil
+		}
+		return nil, err
+	}
+
+	return reloaded.(*interpret.Lexicon), nil
+}
+
+func (s *ProductService) GetCounts(ctx context.Context, productFilter *models.ProductFilter) (*models.Count, error) {
 	return s.Repo.GetCounts(ctx, productFilter)
 }
+
+func (s *ProductService) Suggest(ctx context.Context, prefix string, limit int) (*models.Suggestions, error) {
+	return s.Repo.Suggest(ctx, prefix, limit)
+}
+
+func (s *ProductService) GetFacets(ctx context.Context, productFilter *models.ProductFilter) (*models.Facets, error) {
+	return s.Repo.GetFacets(ctx, productFilter)
+}
+
+func (s *ProductService) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	return s.Repo.GetProductByID(ctx, id)
+}
+
+func (s *ProductService) GetProductByASIN(ctx context.Context, asin string) (*models.Product, error) {
+	return s.Repo.GetProductByASIN(ctx, asin)
+}
+
+func (s *ProductService) UpdateProduct(ctx context.Context, id int, p *models.Product) (*models.Product, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return s.Repo.UpdateProduct(ctx, id, p)
+}
+
+// PatchProduct applies a JSON merge patch: keys present in the body overwrite the
+// stored values, absent keys are left alone and null clears a nullable field. The
+// merged product must still validate.
+func (s *ProductService) PatchProduct(ctx context.Context, id int, body []byte) (*models.Product, error) {
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, &models.ValidationError{Field: "body", Message: "must be a JSON object"}
+	}
+
+	columns := make([]string, 0, len(patch))
+	var nulls []string
+	for key, raw := range patch {
+		if !models.PatchableFields[key] {
+			return nil, &models.ValidationError{Field: key, Message: "cannot be patched"}
+		}
+		if string(raw) == "null" {
+			if !models.NullableFields[key] {
+				return nil, &models.ValidationError{Field: key, Message: "cannot be null"}
+			}
+			nulls = append(nulls, key)
+		}
+		columns = append(columns, key)
+	}
+	if len(columns) == 0 {
+		return nil, &models.ValidationError{Field: "body", Message: "no fields to update"}
+	}
+	sort.Strings(columns)
+
+	current, err := s.Repo.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, current); err != nil {
+		return nil, &models.ValidationError{Field: "body", Message: err.Error()}
+	}
+	// Unmarshal leaves a string untouched for null
+	for _, key := range nulls {
+		current.ClearField(key)
+	}
+	if err := current.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.Repo.PatchProduct(ctx, id, columns, current)
+}
+
+func (s *ProductService) DeleteProduct(ctx context.Context, id int) error {
+	return s.Repo.SoftDeleteProduct(ctx, id)
+}
+
+func (s *ProductService) RestoreProduct(ctx context.Context, id int) (*models.Product, error) {
+	return s.Repo.RestoreProduct(ctx, id)
+}
+
+func (s *ProductService) PurgeProduct(ctx context.Context, id int) error {
+	return s.Repo.PurgeProduct(ctx, id)
+}
+
+func (s *ProductService) UpsertProduct(
+	ctx context.Context,
+	p *models.Product,
+	opts *models.UpsertOptions,
+) (*models.ProductWriteResult, error) {
+
+	if p.ASIN == "" {
+		return nil, &models.ValidationError{Field: "asin", Message: "is required for upsert"}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return s.Repo.UpsertProduct(ctx, p, opts)
+}
+
+func (s *ProductService) UpsertProductsBulk(
+	ctx context.Context,
+	products []models.Product,
+	opts *models.UpsertOptions,
+) ([]models.ProductWriteResult, error) {
+
+	// The batch is written in one transaction, so one invalid row rejects all of them
+	invalid := &models.RowValidationErrors{}
+	for i := range products {
+		var rowErrs []error
+		if products[i].ASIN == "" {
+			rowErrs = append(rowErrs, &models.ValidationError{Field: "asin", Message: "is required for upsert"})
+		}
+		if err := products[i].Validate(); err != nil {
+			rowErrs = append(rowErrs, err)
+		}
+
+		for _, err := range rowErrs {
+			var validationErr *models.ValidationError
+			if errors.As(err, &validationErr) {
+				validationErr.Field = fmt.Sprintf("[%d].%s", i, validationErr.Field)
+				invalid.Errors = append(invalid.Errors, *validationErr)
+			}
+		}
+	}
+	if len(invalid.Errors) > 0 {
+		return nil, invalid
+	}
+	return s.Repo.UpsertProductsBulk(ctx, products, opts)
+}
+
+// AddProductsPartial validates every row up front, writes the valid ones with
+// per-row isolation and reports each index as written or failed. A nil opts
+// inserts; otherwise rows are upserted by ASIN.
+func (s *ProductService) AddProductsPartial(
+	ctx context.Context,
+	products []models.Product,
+	opts *models.UpsertOptions,
+) (*models.BulkResult, error) {
+
+	items := make([]models.BulkItemResult, len(products))
+	valid := make([]models.Product, 0, len(products))
+	validIndexes := make([]int, 0, len(products))
+
+	for i := range products {
+		items[i].Index = i
+
+		err := products[i].Validate()
+		if err == nil && opts != nil && products[i].ASIN == "" {
+			err = &models.ValidationError{Field: "asin", Message: "is required for upsert"}
+		}
+
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			items[i].Status = models.WriteFailed
+			items[i].Error = &models.BulkItemError{
+				Type:    models.ItemErrorValidation,
+				Field:   validationErr.Field,
+				Message: validationErr.Message,
+			}
+			continue
+		}
+
+		valid = append(valid, products[i])
+		validIndexes = append(validIndexes, i)
+	}
+
+	if len(valid) > 0 {
+		written, err := s.Repo.CreateProductsPartial(ctx, valid, opts)
+		if err != nil {
+			return nil, err
+		}
+		for j, item := range written {
+			item.Index = validIndexes[j]
+			items[item.Index] = item
+		}
+	}
+
+	result := &models.BulkResult{Items: make([]models.BulkItemResult, 0, len(items))}
+	for _, item := range items {
+		result.Add(item)
+	}
+
+	return result, nil
+}
+
+func (s *ProductService) ImportProducts(
+	ctx context.Context,
+	src models.ProductSource,
+	opts *models.UpsertOptions,
+) (*models.ImportResult, error) {
+
+	return s.Repo.ImportProducts(ctx, src, opts)
+}
+
+func (s *ProductService) ExportProducts(
+	ctx context.Context,
+	productFilter *models.ProductFilter,
+	fn func(p *models.Product) error,
+) error {
+
+	return s.Repo.ExportProducts(ctx, productFilter, fn)
+}
@@ -0,0 +1,588 @@
+package service
+
+import (
+	"context"
+	"ecommerce_product_listing/models"
+	"ecommerce_product_listing/pagination"
+	"ecommerce_product_listing/repository"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// testCatalog is the fixture every test starts from. Ratings and popularity are
+// missing on some rows so NULL placement is exercised.
+func testCatalog() []models.Product {
+	return []models.Product{
+		{Title: "Wireless Headphones", ASIN: "B001", Description: "Noise cancelling over-ear headphones", Category: "Electronics", Brand: "Sony", Price: 199, Currency: "USD", Stock: 10, AvgRating: ptr(4.6), BoughtInLastMonth: ptr(900)},
+		{Title: "Wired Earbuds", ASIN: "B002", Description: "In-ear earbuds with microphone", Category: "Electronics", Brand: "Sony", Price: 29, Currency: "USD", Stock: 50, AvgRating: ptr(4.1), BoughtInLastMonth: ptr(1500)},
+		{Title: "Bluetooth Speaker", ASIN: "B003", Description: "Portable wireless speaker", Category: "Electronics", Brand: "JBL", Price: 99, Currency: "USD", Stock: 5, BoughtInLastMonth: ptr(300)},
+		{Title: "Running Shoes", ASIN: "B004", Description: "Lightweight trainers", Category: "Sports", Brand: "Nike", Price: 120, Currency: "USD", Stock: 20, AvgRating: ptr(4.4)},
+		{Title: "Yoga Mat", ASIN: "B005", Description: "Non-slip exercise mat", Category: "Sports", Brand: "Gaiam", Price: 25, Currency: "USD", Stock: 0, AvgRating: ptr(4.8), BoughtInLastMonth: ptr(700)},
+		{Title: "Coffee Maker", ASIN: "B006", Description: "Drip coffee maker with timer", Category: "Kitchen", Brand: "Breville", Price: 89, Currency: "USD", Stock: 7, AvgRating: ptr(3.9), BoughtInLastMonth: ptr(300)},
+		{Title: "Chef Knife", ASIN: "B007", Description: "Stainless steel kitchen knife", Category: "Kitchen", Brand: "Wusthof", Price: 150, Currency: "USD", Stock: 3},
+		{Title: "Noise Cancelling Earbuds", ASIN: "B008", Description: "Wireless earbuds with charging case", Category: "Electronics", Brand: "Apple", Price: 249, Currency: "USD", Stock: 12, AvgRating: ptr(4.7), BoughtInLastMonth: ptr(2000), IsBestSeller: true},
+	}
+}
+
+func newTestService(t *testing.T) *ProductService {
+	t.Helper()
+
+	s := &ProductService{Repo: repository.NewMemoryProductRepository()}
+	if _, err := s.AddProductsBulk(context.Background(), testCatalog()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func productIDs(products []models.Product) []int {
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func listIDs(t *testing.T, s *ProductService, f *models.ProductFilter) []int {
+	t.Helper()
+
+	products, _, err := s.ListProducts(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return productIDs(products)
+}
+
+func TestListProductsSortOrder(t *testing.T) {
+	s := newTestService(t)
+
+	tests := []struct {
+		name   string
+		column models.SortByEnum
+		order  models.SortOrderEnum
+		want   []int
+	}{
+		// Out-of-stock product 5 is hidden by default
+		{"popularity desc", models.SortByPopularity, models.SortOrderDesc, []int{8, 2, 1, 6, 3, 7, 4}},
+		{"popularity asc", models.SortByPopularity, models.SortOrderAsc, []int{3, 6, 1, 2, 8, 4, 7}},
+		{"rating desc", models.SortByRating, models.SortOrderDesc, []int{8, 1, 4, 2, 6, 7, 3}},
+		{"rating asc", models.SortByRating, models.SortOrderAsc, []int{6, 2, 4, 1, 8, 3, 7}},
+		{"price asc", models.SortByPrice, models.SortOrderAsc, []int{2, 6, 3, 4, 7, 1, 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := models.NewProductFilter()
+			f.SortByColumn = tt.column
+			f.SortOrder = tt.order
+
+			if got := listIDs(t, s, f); !slices.Equal(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestListProductsKeysetPaging walks every page forward and back through the
+// cursors the handler hands out and checks they cover the one-page listing.
+func TestListProductsKeysetPaging(t *testing.T) {
+	s := newTestService(t)
+
+	for _, column := range []models.SortByEnum{models.SortByPopularity, models.SortByRating, models.SortByPrice} {
+		for _, order := range []models.SortOrderEnum{models.SortOrderAsc, models.SortOrderDesc} {
+			t.Run(string(column)+" "+string(order), func(t *testing.T) {
+				newFilter := func(cursor string) *models.ProductFilter {
+					f := models.NewProductFilter()
+					f.SortByColumn = column
+					f.SortOrder = order
+					f.ShowOutOfStock = true
+					f.PageSize = 3
+					f.Normalize()
+					if cursor != "" {
+						if err := pagination.Apply(f, cursor); err != nil {
+							t.Fatal(err)
+						}
+					}
+					return f
+				}
+
+				all := newFilter("")
+				all.PageSize = 100
+				want := listIDs(t, s, all)
+
+				var pages [][]int
+				var lastPage []models.Product
+				var lastFilter *models.ProductFilter
+				cursor := ""
+				for {
+					f := newFilter(cursor)
+					products, hasMore, err := s.ListProducts(context.Background(), f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					pages = append(pages, productIDs(products))
+					lastPage, lastFilter = products, f
+					if cursor = pagination.Next(f, products, hasMore); cursor == "" {
+						break
+					}
+				}
+				if got := slices.Concat(pages...); !slices.Equal(got, want) {
+					t.Fatalf("forward pages = %v, want %v", pages, want)
+				}
+
+				// Back from the last page, each page matches the one seen going forward
+				cursor = pagination.Prev(lastFilter, lastPage, false)
+				for i := len(pages) - 2; i >= 0; i-- {
+					if cursor == "" {
+						t.Fatalf("no prev cursor before page %d", i)
+					}
+					f := newFilter(cursor)
+					products, hasMore, err := s.ListProducts(context.Background(), f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got := productIDs(products); !slices.Equal(got, pages[i]) {
+						t.Fatalf("backward page %d = %v, want %v", i, got, pages[i])
+					}
+					cursor = pagination.Prev(f, products, hasMore)
+				}
+				if cursor != "" {
+					t.Errorf("first page has a prev cursor")
+				}
+			})
+		}
+	}
+}
+
+func TestListProductsCursorFromOtherQuery(t *testing.T) {
+	s := newTestService(t)
+
+	f := models.NewProductFilter()
+	f.PageSize = 2
+	products, hasMore, err := s.ListProducts(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := pagination.Next(f, products, hasMore)
+
+	other := models.NewProductFilter()
+	other.PageSize = 2
+	other.Category = []string{"Kitchen"}
+	other.Normalize()
+	if err := pagination.Apply(other, cursor); err == nil {
+		t.Fatal("cursor applied to a query with different filters")
+	}
+}
+
+func TestGetCounts(t *testing.T) {
+	s := newTestService(t)
+
+	tests := []struct {
+		name   string
+		mode   models.CountModeEnum
+		cap    int
+		want   int64
+		capped bool
+	}{
+		{"exact", models.ExactCountMode, 0, 4, false},
+		{"estimate", models.EstimateCountMode, 0, 4, false},
+		{"capped under", models.CappedCountMode, 10, 4, false},
+		{"capped over", models.CappedCountMode, 2, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := models.NewProductFilter()
+			f.Category = []string{"Electronics"}
+			f.CountMode = tt.mode
+			f.CountCap = tt.cap
+
+			count, err := s.GetCounts(context.Background(), f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count.Count != tt.want || count.Capped != tt.capped || count.Mode != tt.mode {
+				t.Errorf("count = %+v, want %d (capped %v) in %s mode", count, tt.want, tt.capped, tt.mode)
+			}
+		})
+	}
+}
+
+func TestListProductsTextSearch(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	search := func(searchType models.SearchTypeEnum, text string) []int {
+		f := models.NewProductFilter()
+		f.SearchType = searchType
+		f.SearchQueryText = text
+		f.SortByColumn = models.SortByPrice
+		f.SortOrder = models.SortOrderAsc
+		return listIDs(t, s, f)
+	}
+
+	tests := []struct {
+		name       string
+		searchType models.SearchTypeEnum
+		text       string
+		want       []int
+	}{
+		{"simple substring", models.SimpleTextSearchType, "earbuds", []int{2, 8}},
+		{"fts all words", models.VectorSearchType, "wireless earbuds", []int{8}},
+		{"fts or", models.VectorSearchType, "speaker or knife", []int{3, 7}},
+		{"fts exclusion", models.VectorSearchType, "earbuds -wireless", []int{2}},
+		{"fts phrase", models.VectorSearchType, `"coffee maker"`, []int{6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := search(tt.searchType, tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("synonyms and stop words", func(t *testing.T) {
+		if got := search(models.VectorSearchType, "trainers"); !slices.Equal(got, []int{4}) {
+			t.Fatalf("ids before synonym = %v", got)
+		}
+		if got := search(models.VectorSearchType, "sneakers"); len(got) != 0 {
+			t.Fatalf("ids before synonym = %v", got)
+		}
+		if _, err := s.PutSynonym(ctx, &models.Synonym{Term: "sneakers", Synonyms: []string{"trainers"}}); err != nil {
+			t.Fatal(err)
+		}
+		if got := search(models.VectorSearchType, "sneakers"); !slices.Equal(got, []int{4}) {
+			t.Errorf("ids with synonym = %v, want [4]", got)
+		}
+
+		if got := search(models.VectorSearchType, "cheap sneakers"); len(got) != 0 {
+			t.Fatalf("ids before stop word = %v", got)
+		}
+		if _, err := s.AddStopWord(ctx, &models.StopWord{Word: "cheap"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := search(models.VectorSearchType, "cheap sneakers"); !slices.Equal(got, []int{4}) {
+			t.Errorf("ids with stop word = %v, want [4]", got)
+		}
+	})
+}
+
+func TestListProductsExpression(t *testing.T) {
+	s := newTestService(t)
+
+	tests := []struct {
+		name   string
+		filter string
+		want   []int
+	}{
+		{"eq", `{"eq": {"field": "brand", "value": "Sony"}}`, []int{2, 1}},
+		{"in and range", `{"and": [
+			{"in": {"field": "category", "values": ["Electronics", "Kitchen"]}},
+			{"range": {"field": "price", "gte": 50, "lt": 200}}
+		]}`, []int{6, 3, 7, 1}},
+		{"or", `{"or": [{"eq": {"field": "is_best_seller", "value": true}}, {"range": {"field": "price", "lt": 30}}]}`, []int{2, 8}},
+		// Rows without a rating satisfy "not" of a comparison on it
+		{"not with null", `{"not": {"range": {"field": "avg_rating", "gte": 4.5}}}`, []int{2, 6, 3, 4, 7}},
+		{"exists", `{"exists": {"field": "bought_in_last_month"}}`, []int{2, 6, 3, 1, 8}},
+		{"match field", `{"match": {"field": "description", "query": "EARBUDS"}}`, []int{2, 8}},
+		{"match search vector", `{"match": {"query": "wireless -earbuds"}}`, []int{3, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request models.SearchRequest
+			if err := json.Unmarshal([]byte(`{"sort_by_column": "price", "sort_order": "asc", "filter": `+tt.filter+`}`), &request); err != nil {
+				t.Fatal(err)
+			}
+			f := request.ProductFilter()
+			if err := f.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := listIDs(t, s, f); !slices.Equal(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// vocabularyStore counts vocabulary loads and holds each one until release closes.
+type vocabularyStore struct {
+	*repository.MemoryProductRepository
+	loads   atomic.Int32
+	release chan struct{}
+}
+
+func (s *vocabularyStore) GetVocabulary(ctx context.Context) (*models.Vocabulary, error) {
+	s.loads.Add(1)
+	<-s.release
+	return s.MemoryProductRepository.GetVocabulary(ctx)
+}
+
+func TestInterpretQuerySharesLexiconLoad(t *testing.T) {
+	store := &vocabularyStore{MemoryProductRepository: repository.NewMemoryProductRepository(), release: make(chan struct{})}
+	if _, err := store.CreateProductsBulk(context.Background(), testCatalog()); err != nil {
+		t.Fatal(err)
+	}
+	s := &ProductService{Repo: store}
+
+	var wg sync.WaitGroup
+	filters := make([]*models.ProductFilter, 8)
+	for i := range filters {
+		filters[i] = models.NewProductFilter()
+		filters[i].Interpret = true
+		filters[i].SearchQueryText = "sony earbuds under $50"
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.InterpretQuery(context.Background(), filters[i]); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for store.loads.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(store.release)
+	wg.Wait()
+
+	if loads := store.loads.Load(); loads != 1 {
+		t.Errorf("vocabulary loaded %d times, want 1", loads)
+	}
+	for _, f := range filters {
+		if !slices.Equal(f.Brand, []string{"Sony"}) || f.MaxPrice != 50 || f.SearchQueryText != "earbuds" {
+			t.Errorf("filter = brand %v max price %v search %q", f.Brand, f.MaxPrice, f.SearchQueryText)
+		}
+	}
+}
+
+func TestInterpretQueryOptIn(t *testing.T) {
+	s := newTestService(t)
+
+	f := models.NewProductFilter()
+	f.SearchQueryText = "sony earbuds under $50"
+	in, err := s.InterpretQuery(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in != nil || f.SearchQueryText != "sony earbuds under $50" || f.MaxPrice != models.DefaultMaxPrice {
+		t.Errorf("query interpreted without interpret=true: %+v", f)
+	}
+}
+
+func TestSuggestDedupesTitles(t *testing.T) {
+	s := newTestService(t)
+	// A second listing of the best-selling earbuds, under the same title
+	if _, err := s.AddProductsBulk(context.Background(), []models.Product{
+		{Title: "Wired Earbuds", ASIN: "B009", Category: "Electronics", Brand: "Koss", Price: 19, Currency: "USD", Stock: 4},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	suggestions, err := s.Suggest(context.Background(), "ear", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Noise Cancelling Earbuds", "Wired Earbuds"}
+	if !slices.Equal(suggestions.Titles, want) {
+		t.Errorf("titles = %v, want %v", suggestions.Titles, want)
+	}
+}
+
+func TestUpsertRestoresDeletedProduct(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	if err := s.DeleteProduct(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := models.NewUpsertOptions("price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same price as stored: only the deletion is undone
+	result, err := s.UpsertProduct(ctx, &models.Product{Title: "Bluetooth Speaker", ASIN: "B003", Price: 99, Currency: "USD"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != models.WriteUpdated || result.Product.ID != 3 {
+		t.Fatalf("result = %s product %d, want updated product 3", result.Status, result.Product.ID)
+	}
+	if _, err := s.GetProductByID(ctx, 3); err != nil {
+		t.Errorf("restored product not readable: %v", err)
+	}
+
+	result, err = s.UpsertProduct(ctx, &models.Product{Title: "Bluetooth Speaker", ASIN: "B003", Price: 99, Currency: "USD"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != models.WriteUnchanged {
+		t.Errorf("second upsert status = %s, want unchanged", result.Status)
+	}
+}
+
+func TestUpsertProductsBulkValidatesEveryRow(t *testing.T) {
+	s := newTestService(t)
+
+	opts, err := models.NewUpsertOptions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.UpsertProductsBulk(context.Background(), []models.Product{
+		{Title: "Wired Earbuds", ASIN: "B002", Price: 35, Currency: "USD"},
+		{Title: "Wireless Headphones", ASIN: "B001", Price: -1, Currency: "USD"},
+		{Title: "No ASIN", Price: 10, Currency: "USD"},
+		{ASIN: "B010", Price: 10, Currency: "USD"},
+		{Title: "Neither", Currency: "USD"},
+	}, opts)
+
+	var rowErrs *models.RowValidationErrors
+	if !errors.As(err, &rowErrs) {
+		t.Fatalf("err = %v, want row validation errors", err)
+	}
+	var fields []string
+	for _, e := range rowErrs.Errors {
+		fields = append(fields, e.Field)
+	}
+	if want := []string{"[1].price", "[2].asin", "[3].title", "[4].asin", "[4].price"}; !slices.Equal(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+
+	p, err := s.GetProductByASIN(context.Background(), "B002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Price != 29 {
+		t.Errorf("valid row written despite invalid ones: price %v", p.Price)
+	}
+}
+
+func facetCount(counts []models.FacetCount, value string) int64 {
+	for _, c := range counts {
+		if c.Value == value {
+			return c.Count
+		}
+	}
+	return 0
+}
+
+func TestSoftDeleteHidesProduct(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if err := s.DeleteProduct(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteProduct(ctx, 2); !errors.Is(err, repository.ErrProductNotFound) {
+		t.Errorf("second delete err = %v, want ErrProductNotFound", err)
+	}
+
+	if ids := listIDs(t, s, models.NewProductFilter()); slices.Contains(ids, 2) {
+		t.Errorf("deleted product listed: %v", ids)
+	}
+	if _, err := s.GetProductByID(ctx, 2); !errors.Is(err, repository.ErrProductNotFound) {
+		t.Errorf("get by id err = %v, want ErrProductNotFound", err)
+	}
+	if _, err := s.GetProductByASIN(ctx, "B002"); !errors.Is(err, repository.ErrProductNotFound) {
+		t.Errorf("get by asin err = %v, want ErrProductNotFound", err)
+	}
+
+	f := models.NewProductFilter()
+	f.Category = []string{"Electronics"}
+	count, err := s.GetCounts(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Count != 3 {
+		t.Errorf("electronics count = %d, want 3", count.Count)
+	}
+
+	facets, err := s.GetFacets(ctx, models.NewProductFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := facetCount(facets.Brands, "Sony"); got != 1 {
+		t.Errorf("Sony facet = %d, want 1", got)
+	}
+	if got := facetCount(facets.Categories, "Electronics"); got != 3 {
+		t.Errorf("Electronics facet = %d, want 3", got)
+	}
+
+	restored, err := s.RestoreProduct(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ASIN != "B002" {
+		t.Errorf("restored %+v", restored)
+	}
+	if ids := listIDs(t, s, models.NewProductFilter()); !slices.Contains(ids, 2) {
+		t.Errorf("restored product not listed: %v", ids)
+	}
+	if _, err := s.RestoreProduct(ctx, 2); !errors.Is(err, repository.ErrProductNotFound) {
+		t.Errorf("restoring a live product err = %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestPurgeProduct(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if err := s.DeleteProduct(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PurgeProduct(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreProduct(ctx, 3); !errors.Is(err, repository.ErrProductNotFound) {
+		t.Errorf("restore after purge err = %v, want ErrProductNotFound", err)
+	}
+
+	// The purged ASIN is free again
+	if _, err := s.AddProduct(ctx, &models.Product{Title: "Bluetooth Speaker", ASIN: "B003", Price: 89, Currency: "USD", Stock: 1}); err != nil {
+		t.Errorf("reusing purged ASIN: %v", err)
+	}
+}
+
+func TestGetFacetsPriceHistogram(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.AddProductsBulk(context.Background(), []models.Product{
+		{Title: "Desk Lamp", ASIN: "B020", Category: "Home", Brand: "Ikea", Price: 40, Currency: "EUR", Stock: 2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := models.NewProductFilter()
+	f.PriceBuckets = 4
+	// The price filter narrows the other facets but not the histogram
+	f.MinPrice = 100
+	facets, err := s.GetFacets(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.PriceHistogram{
+		{Currency: "EUR", Min: 40, Max: 40, Buckets: []models.PriceBucket{{Min: 40, Max: 40, Count: 1}}},
+		{Currency: "USD", Min: 29, Max: 249, Buckets: []models.PriceBucket{
+			{Min: 29, Max: 84, Count: 1},
+			{Min: 84, Max: 139, Count: 3},
+			{Min: 139, Max: 194, Count: 1},
+			{Min: 194, Max: 249, Count: 2},
+		}},
+	}
+	got, _ := json.Marshal(facets.Prices)
+	wantJSON, _ := json.Marshal(want)
+	if string(got) != string(wantJSON) {
+		t.Errorf("prices = %s, want %s", got, wantJSON)
+	}
+	if got := facetCount(facets.Brands, "Sony"); got != 1 {
+		t.Errorf("Sony facet = %d, want 1 (only the headphones cost 100 or more)", got)
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"ecommerce_product_listing/models"
+)
+
+func (s *ProductService) ListSynonyms(ctx context.Context) ([]models.Synonym, error) {
+	return s.Repo.ListSynonyms(ctx)
+}
+
+func (s *ProductService) PutSynonym(ctx context.Context, synonym *models.Synonym) (*models.Synonym, error) {
+	if err := synonym.Validate(); err != nil {
+		return nil, err
+	}
+	return s.Repo.PutSynonym(ctx, synonym)
+}
+
+func (s *ProductService) DeleteSynonym(ctx context.Context, term string) error {
+	return s.Repo.DeleteSynonym(ctx, models.NormalizeSearchTerm(term))
+}
+
+func (s *ProductService) ListStopWords(ctx context.Context) ([]models.StopWord, error) {
+	return s.Repo.ListStopWords(ctx)
+}
+
+func (s *ProductService) AddStopWord(ctx context.Context, word *models.StopWord) (*models.StopWord, error) {
+	if err := word.Validate(); err != nil {
+		return nil, err
+	}
+	return s.Repo.AddStopWord(ctx, word)
+}
+
+func (s *ProductService) DeleteStopWord(ctx context.Context, word string) error {
+	return s.Repo.DeleteStopWord(ctx, models.NormalizeSearchTerm(word))
+}